@@ -1,6 +1,6 @@
 module github.com/raf924/bot/v2
 
-go 1.18
+go 1.21
 
 require (
 	github.com/raf924/connector-sdk v1.1.1
@@ -6,16 +6,25 @@ import (
 	_ "github.com/raf924/bot/v2/internal/pkg/bot/permissions"
 	"github.com/raf924/bot/v2/pkg"
 	"github.com/raf924/bot/v2/pkg/bot/permissions"
+	botCommand "github.com/raf924/bot/v2/pkg/command"
 	"github.com/raf924/bot/v2/pkg/config/bot"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/bot/v2/pkg/metrics"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/connector-sdk/rpc"
 	"github.com/raf924/connector-sdk/storage"
-	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
 var _ pkg.Runnable = (*Bot)(nil)
+var _ pkg.Stopper = (*Bot)(nil)
 
 type ban struct {
 	Start    time.Time     `json:"Start"`
@@ -36,6 +45,10 @@ type Bot struct {
 	cancelFunc               func(err error)
 	banStorage               storage.Storage
 	trigger                  string
+	pending                  sync.WaitGroup
+	stopM                    sync.RWMutex
+	stopping                 bool
+	logger                   *slog.Logger
 }
 
 func NewBot(
@@ -44,13 +57,16 @@ func NewBot(
 	commandPermissionManager permissions.PermissionManager,
 	relay rpc.DispatcherRelay,
 	commands command.List,
+	logger *slog.Logger,
 ) *Bot {
+	logger = logging.OrDefault(logger)
 	banStorage, err := storage.NewFileStorage(config.ApiKeys["banStorageLocation"])
 	if err != nil {
-		log.Println(err)
+		logger.Warn("couldn't open ban storage, bans won't be saved", "error", err)
 		banStorage = storage.NewNoOpStorage()
 	}
 	return &Bot{
+		logger:                   logger,
 		users:                    domain.NewUserList(),
 		bans:                     make(map[string]ban),
 		loadedCommands:           make(map[string]command.Command),
@@ -105,8 +121,15 @@ func (b *Bot) Start(ctx context.Context) error {
 	}()
 	b.loadBans()
 	b.initCommands()
-	var err error
-	confirmation, err := b.connectorRelay.Connect(domain.NewRegistrationMessage(b.getCommandList()))
+	err := b.serveMetrics()
+	if err != nil {
+		return err
+	}
+	registration, err := b.handshake().Registration(b.getCommandList())
+	if err != nil {
+		return err
+	}
+	confirmation, err := b.connectorRelay.Connect(registration)
 	if err != nil {
 		return fmt.Errorf("cannot connect to server: %w", err)
 	}
@@ -122,16 +145,19 @@ func (b *Bot) Start(ctx context.Context) error {
 				return fmt.Errorf("bot is down: %v", b.ctx.Err())
 			}
 			if err != nil {
-				log.Println("error running command", err)
+				b.logger.Error("command failed", "error", err)
 				return nil
 			}
 			for _, message := range messages {
 				if b.ctx.Err() != nil {
 					return fmt.Errorf("bot is down: %v", b.ctx.Err())
 				}
+				b.pending.Add(1)
 				go func(message *domain.ClientMessage) {
+					defer b.pending.Done()
 					err := b.connectorRelay.Send(message)
 					if err != nil {
+						sendErrors.Inc()
 						b.cancelFunc(err)
 					}
 				}(message)
@@ -140,6 +166,9 @@ func (b *Bot) Start(ctx context.Context) error {
 		},
 		userPermissionManager:    b.userPermissionManager,
 		commandPermissionManager: b.commandPermissionManager,
+		logger:                   b.logger,
+		cooldownConfig:           b.config.Commands.Cooldowns,
+		cooldownBypass:           b.config.Commands.CooldownBypass,
 	}
 	go func() {
 		for b.ctx.Err() == nil {
@@ -148,25 +177,133 @@ func (b *Bot) Start(ctx context.Context) error {
 				b.cancelFunc(err)
 				return
 			}
-			switch packet := packet.(type) {
-			case *domain.UserEvent:
-				switch packet.EventType() {
-				case domain.UserJoined:
-					b.users.Add(packet.User())
-				case domain.UserLeft:
-					b.users.Remove(packet.User())
-				}
+			if disconnection, ok := packet.(*dispatch.Disconnection); ok {
+				b.cancelFunc(fmt.Errorf("disconnected by the connector: %w", disconnection.Err()))
+				return
 			}
-			go func() {
+			if roster, ok := packet.(*connection.Roster); ok {
+				b.resetUsers(roster)
+				continue
+			}
+			if packet, ok := packet.(*domain.UserEvent); ok {
+				b.updateUsers(packet)
+			}
+			b.track(func() {
 				senderIsBanned := false
 				if packet, ok := packet.(FromUser); ok {
 					senderIsBanned = b.isBanned(packet.Sender())
 				}
-				if err = commandHandler.PassServerMessage(packet, senderIsBanned); err != nil {
+				if err := commandHandler.PassServerMessage(packet, senderIsBanned); err != nil {
 					b.cancelFunc(err)
 					return
 				}
-			}()
+			})
+		}
+	}()
+	return nil
+}
+
+// handshake presents the configured token, name and subscription to the connector, which may send the bot its own messages
+func (b *Bot) handshake() dispatch.Handshake {
+	return dispatch.Handshake{
+		Token:             b.config.Token,
+		Identity:          dispatch.Identity{Name: b.config.Name, Version: b.config.Version},
+		Subscription:      b.config.Subscription,
+		ConnectorMessages: true,
+	}
+}
+
+// updateUsers keeps the online users in sync with the connector's roster
+func (b *Bot) updateUsers(event *domain.UserEvent) {
+	switch event.EventType() {
+	case domain.UserJoined:
+		if b.users.Find(event.User().Nick()) == nil {
+			b.users.Add(event.User())
+		}
+	case domain.UserLeft:
+		b.users.Remove(event.User())
+	}
+}
+
+// resetUsers replaces the online users with those of roster
+func (b *Bot) resetUsers(roster *connection.Roster) {
+	for _, user := range b.users.All() {
+		b.users.Remove(user)
+	}
+	for _, user := range roster.Users() {
+		if b.users.Find(user.Nick()) == nil {
+			b.users.Add(user)
+		}
+	}
+}
+
+// track runs f in a goroutine that Stop waits for. f is dropped if the bot is stopping
+func (b *Bot) track(f func()) {
+	b.stopM.RLock()
+	defer b.stopM.RUnlock()
+	if b.stopping {
+		return
+	}
+	b.pending.Add(1)
+	go func() {
+		defer b.pending.Done()
+		f()
+	}()
+}
+
+// Stop ignores new messages, waits for the commands being run to send their replies until ctx is done
+// and saves the bans and permissions before stopping the bot
+func (b *Bot) Stop(ctx context.Context) error {
+	b.stopM.Lock()
+	b.stopping = true
+	b.stopM.Unlock()
+	drained := make(chan struct{})
+	go func() {
+		b.pending.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = fmt.Errorf("couldn't send pending replies: %w", ctx.Err())
+	}
+	b.saveBans()
+	b.persistPermissions()
+	b.cancelFunc(pkg.ErrStopped)
+	return err
+}
+
+func (b *Bot) persistPermissions() {
+	for _, manager := range []permissions.PermissionManager{b.userPermissionManager, b.commandPermissionManager} {
+		persister, ok := manager.(permissions.PermissionPersister)
+		if !ok {
+			continue
+		}
+		if err := persister.Persist(); err != nil {
+			b.logger.Error("couldn't save permissions", "error", err)
+		}
+	}
+}
+
+func (b *Bot) serveMetrics() error {
+	if len(b.config.Metrics.Address) == 0 {
+		return nil
+	}
+	listener, err := net.Listen("tcp", b.config.Metrics.Address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-b.ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			b.logger.Error("metrics server failed", "error", err)
 		}
 	}()
 	return nil
@@ -196,11 +333,19 @@ func (b *Bot) getCommandList() []*domain.Command {
 		if b.isCommandDisabled(cmd) {
 			continue
 		}
-		commands = append(commands, domain.NewCommand(cmd.Name(), cmd.Aliases(), fmt.Sprintf("%s%s <args>", b.trigger, cmd.Name())))
+		commands = append(commands, domain.NewCommand(cmd.Name(), cmd.Aliases(), b.usage(cmd)))
 	}
 	return commands
 }
 
+func (b *Bot) usage(cmd command.Command) string {
+	documented, ok := cmd.(botCommand.Documented)
+	if !ok {
+		return fmt.Sprintf("%s%s <args>", b.trigger, cmd.Name())
+	}
+	return botCommand.FormatUsage(b.trigger+botCommand.UsageOf(cmd.Name(), documented), documented.Description())
+}
+
 func (b *Bot) disable(cmd command.Command) {
 	b.config.Commands.Disabled[cmd.Name()] = true
 }
@@ -209,12 +354,21 @@ func (b *Bot) initCommands() {
 	b.commands.Add(&builtinCommand{
 		NoOpCommand: command.NoOpCommand{},
 		name:        "ban",
-		execute:     b.ban,
+		description: "Ignores a user's commands for a while, a negative duration bans them forever",
+		arguments: []botCommand.Argument{
+			{Name: "user", Type: botCommand.StringArgument},
+			{Name: "duration", Type: botCommand.DurationArgument},
+		},
+		execute: b.ban,
 	})
 	b.commands.Add(&builtinCommand{
 		NoOpCommand: command.NoOpCommand{},
 		name:        "verify",
-		execute:     b.verify,
+		description: "Manages verified users",
+		arguments: []botCommand.Argument{
+			{Name: "args", Type: botCommand.StringArgument, Variadic: true},
+		},
+		execute: b.verify,
 	})
 	b.commands.Range(func(command command.Command) bool {
 		if b.isCommandDisabled(command) {
@@ -222,7 +376,7 @@ func (b *Bot) initCommands() {
 		}
 		err := command.Init(b)
 		if err != nil {
-			log.Printf("couldn't init %s\n", command.Name())
+			b.logger.Warn("couldn't init command, disabling it", logging.CommandKey, command.Name(), "error", err)
 			b.disable(command)
 		}
 		b.AddCommand(command)
@@ -249,7 +403,7 @@ func (b *Bot) isBanned(user *domain.User) bool {
 func (b *Bot) loadBans() {
 	err := b.banStorage.Load(&b.bans)
 	if err != nil {
-		log.Println("could not load bans: ", err)
+		b.logger.Warn("couldn't load bans", "error", err)
 		return
 	}
 }
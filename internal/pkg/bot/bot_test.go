@@ -2,12 +2,21 @@ package bot
 
 import (
 	"context"
+	"errors"
+	"github.com/raf924/bot/v2/internal/pkg/bot/commands"
 	"github.com/raf924/bot/v2/internal/pkg/rpc"
+	"github.com/raf924/bot/v2/pkg"
 	"github.com/raf924/bot/v2/pkg/bot/permissions"
+	botCommand "github.com/raf924/bot/v2/pkg/command"
 	"github.com/raf924/bot/v2/pkg/config/bot"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/dispatch"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/queue"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -107,7 +116,7 @@ func TestBot(t *testing.T) {
 		},
 		permissions.NewNoCheckPermissionManager(),
 		permissions.NewNoCheckPermissionManager(),
-		rpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(), "!", botUser, clientMessageProducer, serverMessageConsumer),
+		rpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(), "!", botUser, rpc.NewRegistration(), clientMessageProducer, serverMessageConsumer),
 		command.NewCommandList(&testCommand{
 			init: func(executor command.Executor) error {
 				return nil
@@ -129,6 +138,7 @@ func TestBot(t *testing.T) {
 			},
 			ignoreSelf: false,
 		}),
+		nil,
 	)
 	err = b.Start(context.Background())
 	if err != nil {
@@ -138,3 +148,403 @@ func TestBot(t *testing.T) {
 	testReply(t, domain.NewCommandMessage("test", nil, "", user, false, time.Now()), serverMessageProducer, clientMessageConsumer, commandReply)
 	testReply(t, domain.NewUserEvent(user, domain.UserJoined, time.Now()), serverMessageProducer, clientMessageConsumer, userEventReply)
 }
+
+type documentedTestCommand struct {
+	testCommand
+}
+
+func (d *documentedTestCommand) Description() string {
+	return "Tests things"
+}
+
+func (d *documentedTestCommand) Usage() string {
+	return ""
+}
+
+func (d *documentedTestCommand) Arguments() []botCommand.Argument {
+	return []botCommand.Argument{
+		{Name: "count", Type: botCommand.IntArgument},
+		{Name: "rest", Type: botCommand.StringArgument, Optional: true, Variadic: true},
+	}
+}
+
+func TestCommandHandler_ValidatesArguments(t *testing.T) {
+	cmd := &documentedTestCommand{testCommand{
+		execute: func(packet *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+			return []*domain.ClientMessage{commandReply}, nil
+		},
+	}}
+	var replies []*domain.ClientMessage
+	handler := CommandHandler{
+		commands:       domain.NewCommandList(domain.NewCommand(cmd.Name(), cmd.Aliases(), botCommand.FormatUsage("!test <count> [rest...]", cmd.Description()))),
+		loadedCommands: map[string]command.Command{cmd.Name(): cmd},
+		botUser:        botUser,
+		commandCallback: func(messages []*domain.ClientMessage, err error) error {
+			replies = append(replies, messages...)
+			return err
+		},
+		userPermissionManager:    permissions.NewNoCheckPermissionManager(),
+		commandPermissionManager: permissions.NewNoCheckPermissionManager(),
+	}
+	tests := []struct {
+		name  string
+		args  []string
+		reply string
+	}{
+		{name: "missing argument", args: nil, reply: "missing count. Usage: !test <count> [rest...]"},
+		{name: "wrong type", args: []string{"many"}, reply: "count must be a valid int. Usage: !test <count> [rest...]"},
+		{name: "valid", args: []string{"3", "a", "b"}, reply: commandReply.Message()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replies = nil
+			err := handler.PassServerMessage(domain.NewCommandMessage("test", tt.args, "", user, false, time.Now()), false)
+			if err != nil {
+				t.Fatalf("unexpected error = %v", err)
+			}
+			if len(replies) != 1 || replies[0].Message() != tt.reply {
+				t.Fatalf("expected reply %q got %v", tt.reply, replies)
+			}
+		})
+	}
+}
+
+func startTestBot(t *testing.T, cmd command.Command) (*Bot, queue.Producer[domain.ServerMessage], queue.Consumer[*domain.ClientMessage]) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clientMessageQueue := queue.NewQueue[*domain.ClientMessage]()
+	serverMessageQueue := queue.NewQueue[domain.ServerMessage]()
+	clientMessageConsumer, err := clientMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverMessageConsumer, err := serverMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBot(
+		bot.Config{
+			Trigger: "!",
+			ApiKeys: map[string]string{},
+			Users:   bot.UserConfig{AllowAll: true},
+			Commands: bot.CommandConfig{
+				Disabled: map[string]bool{"ban": true, "verify": true},
+			},
+		},
+		permissions.NewNoCheckPermissionManager(),
+		permissions.NewNoCheckPermissionManager(),
+		rpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(), "!", botUser, rpc.NewRegistration(), clientMessageQueue, serverMessageConsumer),
+		command.NewCommandList(cmd),
+		nil,
+	)
+	if err := b.Start(ctx); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	return b, serverMessageQueue, clientMessageConsumer
+}
+
+func TestBot_Stop(t *testing.T) {
+	started := make(chan struct{})
+	b, serverMessages, clientMessages := startTestBot(t, &testCommand{
+		init: func(executor command.Executor) error {
+			return nil
+		},
+		execute: func(packet *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return []*domain.ClientMessage{commandReply}, nil
+		},
+	})
+	err := serverMessages.Produce(domain.NewCommandMessage("test", nil, "", user, false, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if !errors.Is(b.Err(), pkg.ErrStopped) {
+		t.Fatalf("expected the bot to be stopped, got %v", b.Err())
+	}
+	reply, err := clientMessages.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != commandReply {
+		t.Fatalf("expected %v got %v", commandReply, reply)
+	}
+}
+
+func TestBot_Roster(t *testing.T) {
+	var events int64
+	b, serverMessages, _ := startTestBot(t, &testCommand{
+		init: func(executor command.Executor) error {
+			return nil
+		},
+		onUserEvent: func(packet *domain.UserEvent) ([]*domain.ClientMessage, error) {
+			atomic.AddInt64(&events, 1)
+			return nil, nil
+		},
+	})
+	carol := domain.NewUser("carol", "carolId", domain.RegularUser)
+	for _, event := range []domain.ServerMessage{
+		domain.NewUserEvent(carol, domain.UserJoined, time.Now()),
+		connection.NewRoster([]*domain.User{user}, time.Now()),
+		domain.NewUserEvent(user, domain.UserJoined, time.Now()),
+	} {
+		if err := serverMessages.Produce(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		users := b.OnlineUsers().All()
+		if len(users) == 1 && users[0].Nick() == "user" && atomic.LoadInt64(&events) == 2 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected only user to be online and the commands to receive the 2 user events, got %v and %d events", b.OnlineUsers().All(), atomic.LoadInt64(&events))
+}
+
+type mapPermissionManager map[string]domain.Permission
+
+func (m mapPermissionManager) GetPermission(id string) (domain.Permission, error) {
+	return m[id], nil
+}
+
+func (m mapPermissionManager) SetPermission(id string, permission domain.Permission) error {
+	m[id] = permission
+	return nil
+}
+
+type coolingDownTestCommand struct {
+	testCommand
+}
+
+func (c *coolingDownTestCommand) Cooldowns() botCommand.Cooldowns {
+	return botCommand.Cooldowns{User: time.Hour}
+}
+
+func TestCommandHandler_Cooldowns(t *testing.T) {
+	cmd := &coolingDownTestCommand{testCommand{
+		execute: func(packet *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+			return []*domain.ClientMessage{commandReply}, nil
+		},
+	}}
+	other := domain.NewUser("other", "otherId", domain.RegularUser)
+	admin := domain.NewUser("admin", "adminId", domain.RegularUser)
+	newHandler := func(config map[string]botCommand.Cooldowns) (*CommandHandler, *[]*domain.ClientMessage) {
+		var replies []*domain.ClientMessage
+		return &CommandHandler{
+			commands:       domain.NewCommandList(domain.NewCommand(cmd.Name(), cmd.Aliases(), "test")),
+			loadedCommands: map[string]command.Command{cmd.Name(): cmd},
+			botUser:        botUser,
+			commandCallback: func(messages []*domain.ClientMessage, err error) error {
+				replies = append(replies, messages...)
+				return err
+			},
+			userPermissionManager:    mapPermissionManager{user.Id(): domain.IsVerified, other.Id(): domain.IsVerified, admin.Id(): domain.IsAdmin},
+			commandPermissionManager: permissions.NewNoCheckPermissionManager(),
+			cooldownConfig:           config,
+		}, &replies
+	}
+	run := func(t *testing.T, handler *CommandHandler, replies *[]*domain.ClientMessage, sender *domain.User, expected ...string) {
+		t.Helper()
+		*replies = nil
+		if err := handler.PassServerMessage(domain.NewCommandMessage("test", nil, "", sender, false, time.Now()), false); err != nil {
+			t.Fatalf("unexpected error = %v", err)
+		}
+		var messages []string
+		for _, reply := range *replies {
+			messages = append(messages, reply.Message())
+		}
+		if !reflect.DeepEqual(messages, expected) {
+			t.Fatalf("expected replies %q got %q", expected, messages)
+		}
+	}
+	t.Run("declared per user", func(t *testing.T) {
+		handler, replies := newHandler(nil)
+		run(t, handler, replies, user, commandReply.Message())
+		run(t, handler, replies, user, "test is cooling down, try again in 3600s")
+		run(t, handler, replies, user)
+		run(t, handler, replies, other, commandReply.Message())
+		run(t, handler, replies, admin, commandReply.Message())
+		run(t, handler, replies, admin, commandReply.Message())
+	})
+	t.Run("configured per command", func(t *testing.T) {
+		handler, replies := newHandler(map[string]botCommand.Cooldowns{cmd.Name(): {Command: time.Minute}})
+		run(t, handler, replies, user, commandReply.Message())
+		run(t, handler, replies, other, "test is cooling down, try again in 60s")
+		run(t, handler, replies, other)
+	})
+	t.Run("everyone allowed", func(t *testing.T) {
+		handler, replies := newHandler(nil)
+		handler.userPermissionManager = permissions.NewNoCheckPermissionManager()
+		run(t, handler, replies, admin, commandReply.Message())
+		run(t, handler, replies, admin, "test is cooling down, try again in 3600s")
+	})
+}
+
+func TestCooldowns_Expire(t *testing.T) {
+	var c cooldowns
+	now := time.Now()
+	limits := botCommand.Cooldowns{Command: time.Second, User: time.Minute}
+	if wait, _ := c.take("test", "userId", limits, now); wait != 0 {
+		t.Fatal("expected the first invocation to run, wait", wait)
+	}
+	if wait, warn := c.take("test", "otherId", limits, now.Add(time.Second/2)); wait != time.Second/2 || !warn {
+		t.Fatal("expected the command cooldown to apply to other users, wait", wait)
+	}
+	if wait, _ := c.take("test", "otherId", limits, now.Add(time.Second)); wait != 0 {
+		t.Fatal("expected the command cooldown to expire, wait", wait)
+	}
+	if wait, _ := c.take("test", "userId", limits, now.Add(time.Second)); wait != time.Minute-time.Second {
+		t.Fatal("expected the user cooldown to apply, wait", wait)
+	}
+	if wait, _ := c.take("test", "userId", limits, now.Add(time.Minute)); wait != 0 {
+		t.Fatal("expected the user cooldown to expire, wait", wait)
+	}
+}
+
+func TestCommandHandler_EchoWithoutText(t *testing.T) {
+	echo := &commands.EchoCommand{}
+	var replies []*domain.ClientMessage
+	handler := CommandHandler{
+		commands:       domain.NewCommandList(domain.NewCommand(echo.Name(), echo.Aliases(), "echo")),
+		loadedCommands: map[string]command.Command{echo.Name(): echo},
+		botUser:        botUser,
+		commandCallback: func(messages []*domain.ClientMessage, err error) error {
+			replies = append(replies, messages...)
+			return err
+		},
+		userPermissionManager:    permissions.NewNoCheckPermissionManager(),
+		commandPermissionManager: permissions.NewNoCheckPermissionManager(),
+	}
+	if err := handler.PassServerMessage(domain.NewCommandMessage(echo.Name(), nil, "", user, false, time.Now()), false); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if len(replies) != 1 || replies[0].Message() != "" {
+		t.Fatalf("expected an empty echo, got %v", replies)
+	}
+}
+
+func TestCommandHandler_RepliesOnSourceConnection(t *testing.T) {
+	echo := &commands.EchoCommand{}
+	var replies []*domain.ClientMessage
+	handler := CommandHandler{
+		commands:       domain.NewCommandList(domain.NewCommand(echo.Name(), echo.Aliases(), "echo")),
+		loadedCommands: map[string]command.Command{echo.Name(): echo},
+		botUser:        botUser,
+		commandCallback: func(messages []*domain.ClientMessage, err error) error {
+			replies = append(replies, messages...)
+			return err
+		},
+		userPermissionManager:    permissions.NewNoCheckPermissionManager(),
+		commandPermissionManager: permissions.NewNoCheckPermissionManager(),
+	}
+	sender := connection.Qualify("irc", user)
+	if err := handler.PassServerMessage(domain.NewCommandMessage(echo.Name(), []string{"hi"}, "hi", sender, false, time.Now()), false); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if len(replies) != 1 {
+		t.Fatalf("expected a reply, got %v", replies)
+	}
+	name, reply := connection.Destination(replies[0])
+	if name != "irc" || reply.Message() != "hi" || reply.Recipient() != nil {
+		t.Fatalf("expected a public reply on irc, got %q on %q", reply.Message(), name)
+	}
+	replies = nil
+	cloaked := domain.NewUser("alice", "unaffiliated/alice", domain.RegularUser)
+	if err := handler.PassServerMessage(domain.NewCommandMessage(echo.Name(), []string{"hi"}, "hi", cloaked, false, time.Now()), false); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if len(replies) != 1 || replies[0].Recipient() != nil {
+		t.Fatalf("expected the reply to an unqualified id to stay public, got %v", replies)
+	}
+	if emote := connection.ReplyOn(connection.Of(cloaked), domain.NewEmote("waves")); !emote.Emote() {
+		t.Fatal("expected an emote to an unqualified id to stay an emote")
+	}
+}
+
+func TestBot_RosterOfSeveralConnections(t *testing.T) {
+	b, serverMessages, _ := startTestBot(t, &testCommand{
+		init: func(executor command.Executor) error {
+			return nil
+		},
+		onUserEvent: func(packet *domain.UserEvent) ([]*domain.ClientMessage, error) {
+			return nil, nil
+		},
+	})
+	for _, name := range []string{"irc", "discord"} {
+		if err := serverMessages.Produce(domain.NewUserEvent(connection.Qualify(name, user), domain.UserJoined, time.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if len(b.OnlineUsers().All()) == 2 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected user to be online on both connections, got %v", b.OnlineUsers().All())
+}
+
+func TestBot_Disconnection(t *testing.T) {
+	b, serverMessages, _ := startTestBot(t, &testCommand{
+		init: func(executor command.Executor) error {
+			return nil
+		},
+	})
+	if err := serverMessages.Produce(dispatch.NewDisconnection(errors.New("queue is full"), time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-b.Done():
+		if err := b.Err(); err == nil || !strings.Contains(err.Error(), "queue is full") {
+			t.Fatal("expected the bot to stop with the connector's reason, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the bot to stop")
+	}
+}
+
+func TestCommandHandler_VerifyWithoutArgs(t *testing.T) {
+	b := NewBot(bot.Config{Trigger: "!"}, permissions.NewNoCheckPermissionManager(), permissions.NewNoCheckPermissionManager(), nil, command.NewCommandList(), nil)
+	b.initCommands()
+	var replies []*domain.ClientMessage
+	handler := CommandHandler{
+		commands:       domain.NewCommandList(b.getCommandList()...),
+		loadedCommands: b.loadedCommands,
+		botUser:        botUser,
+		commandCallback: func(messages []*domain.ClientMessage, err error) error {
+			replies = append(replies, messages...)
+			return err
+		},
+		userPermissionManager:    permissions.NewNoCheckPermissionManager(),
+		commandPermissionManager: permissions.NewNoCheckPermissionManager(),
+	}
+	if err := handler.PassServerMessage(domain.NewCommandMessage("verify", nil, "", user, false, time.Now()), false); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if len(replies) != 1 || !strings.HasPrefix(replies[0].Message(), "missing args.") {
+		t.Fatalf("expected a usage reply, got %v", replies)
+	}
+}
+
+func TestBot_BanOnNamedConnection(t *testing.T) {
+	b := NewBot(bot.Config{Trigger: "!"}, permissions.NewNoCheckPermissionManager(), permissions.NewNoCheckPermissionManager(), nil, command.NewCommandList(), nil)
+	sender := connection.Qualify("irc", domain.NewUser("bob", "bobId", domain.RegularUser))
+	if _, err := b.ban(domain.NewCommandMessage("ban", []string{"@user", "1h"}, "@user 1h", sender, false, time.Now())); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if !b.isBanned(connection.Qualify("irc", user)) {
+		t.Fatal("expected the user to be banned on the sender's connection")
+	}
+	if b.isBanned(connection.Qualify("discord", user)) {
+		t.Fatal("expected the user not to be banned on other connections")
+	}
+}
@@ -2,23 +2,40 @@ package bot
 
 import (
 	"fmt"
+	botCommand "github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/bot/v2/pkg/connection"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
-	"strconv"
 	"strings"
 	"time"
 )
 
+var _ botCommand.Documented = (*builtinCommand)(nil)
+
 type builtinCommand struct {
 	command.NoOpCommand
-	name    string
-	execute func(command *domain.CommandMessage) ([]*domain.ClientMessage, error)
+	name        string
+	description string
+	arguments   []botCommand.Argument
+	execute     func(command *domain.CommandMessage) ([]*domain.ClientMessage, error)
 }
 
 func (c *builtinCommand) Name() string {
 	return c.name
 }
 
+func (c *builtinCommand) Description() string {
+	return c.description
+}
+
+func (c *builtinCommand) Usage() string {
+	return ""
+}
+
+func (c *builtinCommand) Arguments() []botCommand.Argument {
+	return c.arguments
+}
+
 func (c *builtinCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
 	return c.execute(command)
 }
@@ -42,6 +59,9 @@ func (b *Bot) verifyId(id string) bool {
 
 func (b *Bot) verify(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
 	args := command.Args()
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing args")
+	}
 	op := args[len(args)-1]
 	packet := &domain.ClientMessage{}
 	switch op {
@@ -61,19 +81,17 @@ func (b *Bot) ban(command *domain.CommandMessage) ([]*domain.ClientMessage, erro
 		return nil, fmt.Errorf("missing args")
 	}
 	userToBan := strings.TrimLeft(args[0], "@")
-	duration, err := time.ParseDuration(args[1])
+	// bans are keyed by nick as the bot sees it, qualified with the connection of the sender
+	target := connection.Qualify(connection.Of(command.Sender()), domain.NewUser(userToBan, "", domain.RegularUser))
+	duration, err := botCommand.ParseDuration(args[1])
 	if err != nil {
-		seconds, err := strconv.ParseInt(args[1], 10, 64)
-		if err != nil {
-			return nil, err
-		}
-		duration = time.Duration(seconds) * time.Second
+		return nil, err
 	}
 	banInfo := ban{
 		Start:    time.Now(),
 		Duration: duration,
 	}
-	b.bans[userToBan] = banInfo
+	b.bans[target.Nick()] = banInfo
 	var banEnd string
 	if duration < 0 {
 		banEnd = "the end of times"
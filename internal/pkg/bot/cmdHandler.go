@@ -1,9 +1,16 @@
 package bot
 
 import (
+	"fmt"
 	"github.com/raf924/bot/v2/pkg/bot/permissions"
+	botCommand "github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
+	"log/slog"
+	"math"
+	"time"
 )
 
 type CommandHandler struct {
@@ -13,13 +20,20 @@ type CommandHandler struct {
 	commandCallback          func([]*domain.ClientMessage, error) error
 	userPermissionManager    permissions.PermissionManager
 	commandPermissionManager permissions.PermissionManager
+	logger                   *slog.Logger
+	// cooldownConfig overrides the cooldowns declared by the commands
+	cooldownConfig map[string]botCommand.Cooldowns
+	// cooldownBypass is the permission letting users ignore cooldowns, it defaults to domain.NeedAdmin
+	cooldownBypass domain.Permission
+	cooldowns      cooldowns
 }
 
 func (c *CommandHandler) PassServerMessage(message domain.ServerMessage, senderIsBanned bool) error {
 	if message, ok := message.(*domain.UserEvent); ok {
+		callback := c.replyOn(connection.Of(message.User()))
 		for _, cmd := range c.commands.All() {
 			var chatInterceptor command.Interceptor = c.loadedCommands[cmd.Name()]
-			err := c.commandCallback(chatInterceptor.OnUserEvent(message))
+			err := callback(chatInterceptor.OnUserEvent(message))
 			if err != nil {
 				return err
 			}
@@ -27,6 +41,7 @@ func (c *CommandHandler) PassServerMessage(message domain.ServerMessage, senderI
 		return nil
 	}
 	var sender = message.(FromUser).Sender()
+	callback := c.replyOn(connection.Of(sender))
 	switch message := message.(type) {
 	case *domain.ChatMessage:
 		for _, cmd := range c.commands.All() {
@@ -37,13 +52,15 @@ func (c *CommandHandler) PassServerMessage(message domain.ServerMessage, senderI
 			if !message.Incoming() && chatInterceptor.IgnoreSelf() {
 				continue
 			}
-			err := c.commandCallback(chatInterceptor.OnChat(message))
+			err := callback(chatInterceptor.OnChat(message))
 			if err != nil {
 				return err
 			}
 		}
 	case *domain.CommandMessage:
 		if senderIsBanned {
+			banDrops.Inc()
+			c.log().Debug("ignoring banned user", logging.CommandKey, message.Command(), logging.UserKey, sender.Id())
 			return nil
 		}
 		cmd := c.commands.Find(message.Command())
@@ -51,13 +68,36 @@ func (c *CommandHandler) PassServerMessage(message domain.ServerMessage, senderI
 			return c.PassServerMessage(message.ToChatMessage(), senderIsBanned)
 		}
 		if !c.isAllowed(cmd.Name(), sender) {
+			permissionDenials.Inc(cmd.Name())
+			c.log().Info("permission denied", logging.CommandKey, cmd.Name(), logging.UserKey, sender.Id())
 			return nil
 		}
 		var executable = c.loadedCommands[cmd.Name()]
 		if executable.IgnoreSelf() && message.Sender().Is(c.botUser) {
 			return nil
 		}
-		err := c.commandCallback(executable.Execute(message))
+		if documented, ok := executable.(botCommand.Documented); ok {
+			if err := botCommand.ValidateArguments(documented.Arguments(), message.Args()); err != nil {
+				usage, _ := botCommand.ParseUsage(cmd.Usage())
+				reply := domain.NewClientMessage(fmt.Sprintf("%v. Usage: %s", err, usage), sender, message.Private())
+				return callback([]*domain.ClientMessage{reply}, nil)
+			}
+		}
+		if wait, warn := c.coolDown(cmd.Name(), executable, sender); wait > 0 {
+			cooldownDrops.Inc(cmd.Name())
+			c.log().Debug("command is cooling down", logging.CommandKey, cmd.Name(), logging.UserKey, sender.Id(), "wait", wait)
+			if !warn {
+				return nil
+			}
+			seconds := int(math.Ceil(wait.Seconds()))
+			reply := domain.NewClientMessage(fmt.Sprintf("%s is cooling down, try again in %ds", cmd.Name(), seconds), sender, message.Private())
+			return callback([]*domain.ClientMessage{reply}, nil)
+		}
+		start := time.Now()
+		replies, err := executable.Execute(message)
+		commandDuration.Observe(time.Since(start).Seconds(), cmd.Name())
+		commandsExecuted.Inc(cmd.Name())
+		err = callback(replies, err)
 		if err != nil {
 			return err
 		}
@@ -65,6 +105,52 @@ func (c *CommandHandler) PassServerMessage(message domain.ServerMessage, senderI
 	return nil
 }
 
+// replyOn returns the command callback for the replies to a message received on the connection called source,
+// which addresses them to that connection
+func (c *CommandHandler) replyOn(source string) func([]*domain.ClientMessage, error) error {
+	return func(replies []*domain.ClientMessage, err error) error {
+		routed := make([]*domain.ClientMessage, 0, len(replies))
+		for _, reply := range replies {
+			routed = append(routed, connection.ReplyOn(source, reply))
+		}
+		return c.commandCallback(routed, err)
+	}
+}
+
+func (c *CommandHandler) log() *slog.Logger {
+	return logging.OrDefault(c.logger)
+}
+
+func (c *CommandHandler) cooldownsOf(name string, executable command.Command) botCommand.Cooldowns {
+	if limits, ok := c.cooldownConfig[name]; ok {
+		return limits
+	}
+	if coolingDown, ok := executable.(botCommand.CoolingDown); ok {
+		return coolingDown.Cooldowns()
+	}
+	return botCommand.Cooldowns{}
+}
+
+// coolDown returns how long user must wait before running the command called name, starting its cooldowns if it may run now.
+// It also tells whether the user hasn't been told to wait yet
+func (c *CommandHandler) coolDown(name string, executable command.Command, user *domain.User) (time.Duration, bool) {
+	limits := c.cooldownsOf(name, executable)
+	if limits.Command <= 0 && limits.User <= 0 {
+		return 0, false
+	}
+	bypass := c.cooldownBypass
+	if bypass == domain.IsUnknown {
+		bypass = domain.NeedAdmin
+	}
+	// a manager letting everyone in doesn't tell who may bypass cooldowns
+	if permissions.Checks(c.userPermissionManager) {
+		if permission, err := c.userPermissionManager.GetPermission(user.Id()); err == nil && permission.Has(bypass) {
+			return 0, false
+		}
+	}
+	return c.cooldowns.take(name, user.Id(), limits, time.Now())
+}
+
 func (c *CommandHandler) isAllowed(command string, user *domain.User) bool {
 	uPermission, err := c.userPermissionManager.GetPermission(user.Id())
 	if err != nil {
@@ -1,11 +1,14 @@
 package commands
 
 import (
+	botCommand "github.com/raf924/bot/v2/pkg/command"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/domain"
 	"strings"
 )
 
+var _ botCommand.Documented = (*EchoCommand)(nil)
+
 type EchoCommand struct {
 	command.NoOpInterceptor
 }
@@ -22,6 +25,18 @@ func (e *EchoCommand) Aliases() []string {
 	return []string{"e"}
 }
 
+func (e *EchoCommand) Description() string {
+	return "Repeats the given text"
+}
+
+func (e *EchoCommand) Usage() string {
+	return ""
+}
+
+func (e *EchoCommand) Arguments() []botCommand.Argument {
+	return []botCommand.Argument{{Name: "text", Type: botCommand.StringArgument, Optional: true, Variadic: true}}
+}
+
 func (e *EchoCommand) Execute(command *domain.CommandMessage) ([]*domain.ClientMessage, error) {
 	packet := domain.NewClientMessage(strings.Join(command.Args(), " "), nil, command.Private())
 	return []*domain.ClientMessage{packet}, nil
@@ -0,0 +1,66 @@
+package bot
+
+import (
+	botCommand "github.com/raf924/bot/v2/pkg/command"
+	"sync"
+	"time"
+)
+
+// pruneThreshold is how many cooldowns are kept before the expired ones are forgotten
+const pruneThreshold = 1024
+
+type cooldown struct {
+	until time.Time
+	// warned is set once the user has been told to wait
+	warned bool
+}
+
+// cooldowns tracks when commands may run again. Its zero value is ready to use
+type cooldowns struct {
+	m        sync.Mutex
+	commands map[string]*cooldown
+	users    map[string]*cooldown
+}
+
+func (c *cooldowns) get(m *map[string]*cooldown, key string, now time.Time) *cooldown {
+	if *m == nil {
+		*m = map[string]*cooldown{}
+	}
+	if len(*m) > pruneThreshold {
+		for k, cd := range *m {
+			if !now.Before(cd.until) {
+				delete(*m, k)
+			}
+		}
+	}
+	cd, ok := (*m)[key]
+	if !ok {
+		cd = &cooldown{}
+		(*m)[key] = cd
+	}
+	return cd
+}
+
+// take starts the cooldowns of command for user if it may run now.
+// Otherwise it returns how long the user must wait and whether they haven't been told yet
+func (c *cooldowns) take(command string, userId string, limits botCommand.Cooldowns, now time.Time) (time.Duration, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	commandCooldown := c.get(&c.commands, command, now)
+	userCooldown := c.get(&c.users, command+"\x00"+userId, now)
+	wait := commandCooldown.until.Sub(now)
+	if userWait := userCooldown.until.Sub(now); userWait > wait {
+		wait = userWait
+	}
+	if wait > 0 {
+		warn := !userCooldown.warned
+		userCooldown.warned = true
+		if userCooldown.until.Before(now.Add(wait)) {
+			userCooldown.until = now.Add(wait)
+		}
+		return wait, warn
+	}
+	*commandCooldown = cooldown{until: now.Add(limits.Command)}
+	*userCooldown = cooldown{until: now.Add(limits.User)}
+	return 0, false
+}
@@ -0,0 +1,12 @@
+package bot
+
+import "github.com/raf924/bot/v2/pkg/metrics"
+
+var (
+	commandsExecuted  = metrics.NewCounter("bot_commands_executed_total", "Commands executed", "command")
+	commandDuration   = metrics.NewHistogram("bot_command_duration_seconds", "Time spent executing commands", nil, "command")
+	permissionDenials = metrics.NewCounter("bot_permission_denials_total", "Commands refused because their sender lacks the permission", "command")
+	cooldownDrops     = metrics.NewCounter("bot_cooldown_drops_total", "Commands ignored because they are cooling down", "command")
+	banDrops          = metrics.NewCounter("bot_ban_drops_total", "Commands ignored because their sender is banned")
+	sendErrors        = metrics.NewCounter("bot_send_errors_total", "Replies that couldn't be sent to the connector")
+)
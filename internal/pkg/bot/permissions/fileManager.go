@@ -5,7 +5,9 @@ import (
 	"github.com/raf924/bot/v2/pkg/bot/permissions"
 	"github.com/raf924/connector-sdk/domain"
 	"gopkg.in/yaml.v2"
+	"io"
 	"os"
+	"sync"
 )
 
 func init() {
@@ -21,13 +23,18 @@ type Encoder interface {
 	Encode(v interface{}) error
 }
 
+var _ permissions.PermissionPersister = (*filePermissionManager)(nil)
+
 type filePermissionManager struct {
+	m           sync.Mutex
+	fileName    string
 	permissions map[string]domain.Permission
-	encoder     Encoder
-	decoder     Decoder
+	newEncoder  func(w io.Writer) Encoder
 }
 
 func (f *filePermissionManager) GetPermission(id string) (domain.Permission, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
 	p, ok := f.permissions[id]
 	if !ok {
 		return domain.IsUnknown, nil
@@ -36,42 +43,62 @@ func (f *filePermissionManager) GetPermission(id string) (domain.Permission, err
 }
 
 func (f *filePermissionManager) SetPermission(id string, permission domain.Permission) error {
+	f.m.Lock()
 	f.permissions[id] = permission
-	return f.encoder.Encode(f.permissions)
+	f.m.Unlock()
+	return f.Persist()
 }
 
-func newJsonFileManager(fileName string) permissions.PermissionManager {
-	f, err := os.Open(fileName)
+func (f *filePermissionManager) Persist() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	file, err := os.OpenFile(f.fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return nil
+		return err
 	}
-	encoder := json.NewEncoder(f)
-	decoder := json.NewDecoder(f)
-	var perms map[string]domain.Permission
-	if err := decoder.Decode(&perms); err != nil {
-		return nil
+	encoder := f.newEncoder(file)
+	err = encoder.Encode(f.permissions)
+	if closer, ok := encoder.(io.Closer); ok && err == nil {
+		err = closer.Close()
 	}
-	return &filePermissionManager{
-		permissions: perms,
-		encoder:     encoder,
-		decoder:     decoder,
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
+	return err
 }
 
-func newYamlFileManager(fileName string) permissions.PermissionManager {
+func newFileManager(fileName string, newDecoder func(r io.Reader) Decoder, newEncoder func(w io.Writer) Encoder) permissions.PermissionManager {
 	f, err := os.Open(fileName)
 	if err != nil {
 		return nil
 	}
-	encoder := yaml.NewEncoder(f)
-	decoder := yaml.NewDecoder(f)
+	defer f.Close()
 	var perms map[string]domain.Permission
-	if err := decoder.Decode(&perms); err != nil {
+	if err := newDecoder(f).Decode(&perms); err != nil {
 		return nil
 	}
+	if perms == nil {
+		perms = map[string]domain.Permission{}
+	}
 	return &filePermissionManager{
+		fileName:    fileName,
 		permissions: perms,
-		encoder:     encoder,
-		decoder:     decoder,
+		newEncoder:  newEncoder,
 	}
 }
+
+func newJsonFileManager(fileName string) permissions.PermissionManager {
+	return newFileManager(fileName, func(r io.Reader) Decoder {
+		return json.NewDecoder(r)
+	}, func(w io.Writer) Encoder {
+		return json.NewEncoder(w)
+	})
+}
+
+func newYamlFileManager(fileName string) permissions.PermissionManager {
+	return newFileManager(fileName, func(r io.Reader) Decoder {
+		return yaml.NewDecoder(r)
+	}, func(w io.Writer) Encoder {
+		return yaml.NewEncoder(w)
+	})
+}
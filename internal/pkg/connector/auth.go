@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/connector-sdk/domain"
+)
+
+var (
+	errMissingToken = errors.New("missing token")
+	errInvalidToken = errors.New("invalid token")
+)
+
+// tokenAuthenticator accepts the dispatchers presenting one of the configured tokens.
+// A name given to a bot can only be claimed with that bot's token
+type tokenAuthenticator struct {
+	config connector.AuthConfig
+}
+
+var _ dispatch.Authenticator = (*tokenAuthenticator)(nil)
+
+// newTokenAuthenticator returns nil when no token is configured
+func newTokenAuthenticator(config connector.AuthConfig) dispatch.Authenticator {
+	if len(config.Tokens) == 0 && len(config.Bots) == 0 {
+		return nil
+	}
+	return &tokenAuthenticator{config: config}
+}
+
+func tokensEqual(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (a *tokenAuthenticator) Authenticate(handshake dispatch.Handshake, commands domain.CommandList) error {
+	token := handshake.Token
+	if len(token) == 0 {
+		return errMissingToken
+	}
+	name := handshake.Identity.Name
+	for _, shared := range a.config.Tokens {
+		if !tokensEqual(token, shared) {
+			continue
+		}
+		for _, bot := range a.config.Bots {
+			if len(name) > 0 && name == bot.Name {
+				return fmt.Errorf("%s must present its own token", name)
+			}
+		}
+		return nil
+	}
+	for _, bot := range a.config.Bots {
+		if !tokensEqual(token, bot.Token) {
+			continue
+		}
+		if len(name) > 0 && name != bot.Name {
+			return fmt.Errorf("%s may not name itself %s", bot.Name, name)
+		}
+		allowed := map[string]bool{}
+		for _, name := range bot.Commands {
+			allowed[name] = true
+		}
+		for _, cmd := range commands.All() {
+			for _, name := range append([]string{cmd.Name()}, cmd.Aliases()...) {
+				if !allowed[name] {
+					return fmt.Errorf("%s may not register %s", bot.Name, name)
+				}
+			}
+		}
+		return nil
+	}
+	return errInvalidToken
+}
@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/connector-sdk/domain"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultBridgeFormat = "[{connection}] <{nick}> {message}"
+	// bridgeQueueSize is how many relayed messages may wait for each connection before new ones are dropped
+	bridgeQueueSize = 256
+)
+
+type bridgeRoute struct {
+	to      *chatConnection
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func (r *bridgeRoute) accepts(message string) bool {
+	if r.include != nil && !r.include.MatchString(message) {
+		return false
+	}
+	return r.exclude == nil || !r.exclude.MatchString(message)
+}
+
+// bridge mirrors the public messages and the user events of each connection to the others.
+// Relayed messages wait in the queue of the connection they are sent to so that a slow connection doesn't hold up the others
+type bridge struct {
+	format   string
+	announce bool
+	routes   map[*chatConnection][]*bridgeRoute
+	queues   map[*chatConnection]chan *domain.ClientMessage
+}
+
+func compile(expression string) (*regexp.Regexp, error) {
+	if len(expression) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(expression)
+}
+
+func newBridge(config connector.BridgeConfig, connections []*chatConnection) (*bridge, error) {
+	b := &bridge{format: config.Format, announce: config.Announce, routes: map[*chatConnection][]*bridgeRoute{}, queues: map[*chatConnection]chan *domain.ClientMessage{}}
+	for _, cc := range connections {
+		b.queues[cc] = make(chan *domain.ClientMessage, bridgeQueueSize)
+	}
+	if len(b.format) == 0 {
+		b.format = defaultBridgeFormat
+	}
+	if len(config.Routes) == 0 {
+		for _, from := range connections {
+			for _, to := range connections {
+				if from != to {
+					b.routes[from] = append(b.routes[from], &bridgeRoute{to: to})
+				}
+			}
+		}
+		return b, nil
+	}
+	find := func(name string) (*chatConnection, error) {
+		for _, cc := range connections {
+			if cc.name == name {
+				return cc, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown connection %q", name)
+	}
+	for _, routeConfig := range config.Routes {
+		from, err := find(routeConfig.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := find(routeConfig.To)
+		if err != nil {
+			return nil, err
+		}
+		if from == to {
+			return nil, fmt.Errorf("connection %q can't be bridged to itself", from.name)
+		}
+		route := &bridgeRoute{to: to}
+		if route.include, err = compile(routeConfig.Include); err != nil {
+			return nil, err
+		}
+		if route.exclude, err = compile(routeConfig.Exclude); err != nil {
+			return nil, err
+		}
+		b.routes[from] = append(b.routes[from], route)
+	}
+	return b, nil
+}
+
+// isBot tells whether user is the connector itself on cc, its messages must not be relayed again
+func isBot(cc *chatConnection, user *domain.User) bool {
+	return user != nil && cc.botUser != nil && cc.qualify(user).Id() == cc.qualify(cc.botUser).Id()
+}
+
+// pending returns the number of relayed messages waiting to be sent
+func (b *bridge) pending() int {
+	pending := 0
+	for _, queue := range b.queues {
+		pending += len(queue)
+	}
+	return pending
+}
+
+// relay queues m to be sent to the connection to, dropping it if too many messages are already waiting
+func (c *Connector) relay(from *chatConnection, to *chatConnection, m *domain.ClientMessage) {
+	select {
+	case c.bridge.queues[to] <- m:
+	default:
+		bridgeDrops.Inc(to.name)
+		c.logger.Warn("bridge queue is full, message dropped", "from", from.name, "to", to.name)
+	}
+}
+
+// runBridge sends the messages relayed to cc until the connector is done
+func (c *Connector) runBridge(cc *chatConnection) {
+	queue := c.bridge.queues[cc]
+	for {
+		select {
+		case m := <-queue:
+			if err := c.sendTo(cc, m); err != nil {
+				c.logger.Warn("couldn't relay message", "to", cc.name, "error", err)
+			}
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+func (b *bridge) text(from *chatConnection, nick string, message string) string {
+	return strings.NewReplacer("{connection}", from.name, "{nick}", nick, "{message}", message).Replace(b.format)
+}
+
+// mirror relays mP, received from cc, to the connections it is bridged to
+func (c *Connector) mirror(cc *chatConnection, mP *domain.ChatMessage) {
+	if c.bridge == nil || mP.Private() || !mP.Incoming() || isBot(cc, mP.Sender()) {
+		return
+	}
+	text := c.bridge.text(cc, mP.Sender().Nick(), mP.Message())
+	for _, route := range c.bridge.routes[cc] {
+		if !route.accepts(mP.Message()) {
+			continue
+		}
+		c.relay(cc, route.to, domain.NewClientMessage(text, nil, false))
+	}
+}
+
+// announce tells the connections cc is bridged to that user joined or left it
+func (c *Connector) announce(cc *chatConnection, user *domain.User, event domain.UserEventType) {
+	if c.bridge == nil || !c.bridge.announce || isBot(cc, user) {
+		return
+	}
+	action := "joined"
+	if event == domain.UserLeft {
+		action = "left"
+	}
+	text := fmt.Sprintf("%s %s %s", user.Nick(), action, cc.name)
+	for _, route := range c.bridge.routes[cc] {
+		c.relay(cc, route.to, domain.NewClientMessage(text, nil, false))
+	}
+}
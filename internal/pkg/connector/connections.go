@@ -0,0 +1,156 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Connection is a chat connection served by a Connector
+type Connection struct {
+	// Name qualifies the ids and nicks of the connection's users, it can only be empty when the connector serves a single connection
+	Name string
+	// Trigger defaults to the connector's trigger
+	Trigger string
+	Relay   rpc.ConnectionRelay
+	// MaxLength and Unit default to the connector's message settings
+	MaxLength int
+	Unit      connector.LengthUnit
+}
+
+type chatConnection struct {
+	name       string
+	trigger    string
+	relay      rpc.ConnectionRelay
+	users      roster
+	botUser    *domain.User
+	connected  int32
+	reconnectM sync.Mutex
+	// reconnecting is closed once the reconnection in progress is over, it is nil when there is none
+	reconnecting chan struct{}
+	generation   uint64
+	rateLimiter  *rateLimiter
+	pager        pager
+	maxLength    int
+	unit         connector.LengthUnit
+}
+
+func newChatConnection(config connector.Config, conn Connection) *chatConnection {
+	trigger := conn.Trigger
+	if len(trigger) == 0 {
+		trigger = config.Trigger
+	}
+	maxLength, unit := conn.MaxLength, conn.Unit
+	if maxLength <= 0 {
+		maxLength = config.Messages.MaxLength
+	}
+	if len(unit) == 0 {
+		unit = config.Messages.Unit
+	}
+	return &chatConnection{
+		name:        conn.Name,
+		trigger:     trigger,
+		relay:       conn.Relay,
+		rateLimiter: newRateLimiter(config.RateLimit),
+		maxLength:   maxLength,
+		unit:        unit,
+	}
+}
+
+func validateConnections(connections []*chatConnection) error {
+	if len(connections) == 0 {
+		return fmt.Errorf("no connection to serve")
+	}
+	for _, cc := range connections {
+		if cc.relay == nil {
+			return fmt.Errorf("connection %q has no relay", cc.name)
+		}
+	}
+	if len(connections) == 1 {
+		return nil
+	}
+	names := map[string]bool{}
+	for _, cc := range connections {
+		if len(cc.name) == 0 || strings.Contains(cc.name, "/") {
+			return fmt.Errorf("invalid connection name %q", cc.name)
+		}
+		if names[cc.name] {
+			return fmt.Errorf("duplicate connection name %q", cc.name)
+		}
+		names[cc.name] = true
+	}
+	return nil
+}
+
+// qualify returns user as the dispatchers see it
+func (cc *chatConnection) qualify(user *domain.User) *domain.User {
+	return connection.Qualify(cc.name, user)
+}
+
+func (cc *chatConnection) qualifyAll(users []*domain.User) []*domain.User {
+	qualified := make([]*domain.User, 0, len(users))
+	for _, user := range users {
+		qualified = append(qualified, cc.qualify(user))
+	}
+	return qualified
+}
+
+// qualifyMessage returns mP as the dispatchers see it
+func (cc *chatConnection) qualifyMessage(mP *domain.ChatMessage) *domain.ChatMessage {
+	if len(cc.name) == 0 {
+		return mP
+	}
+	return domain.NewChatMessage(mP.Message(), cc.qualify(mP.Sender()), cc.qualifyAll(mP.Recipients()), mP.MentionsConnectorUser(), mP.Private(), mP.Timestamp(), mP.Incoming())
+}
+
+func (cc *chatConnection) onlineUsers() domain.UserList {
+	return cc.users.list()
+}
+
+func (cc *chatConnection) isConnected() bool {
+	return atomic.LoadInt32(&cc.connected) == 1
+}
+
+func (cc *chatConnection) setConnected(connected bool) {
+	var value int32
+	if connected {
+		value = 1
+	}
+	atomic.StoreInt32(&cc.connected, value)
+}
+
+func (cc *chatConnection) connectionGeneration() uint64 {
+	return atomic.LoadUint64(&cc.generation)
+}
+
+// onlineUsers returns the users of every connection as the dispatchers see them
+func (c *Connector) onlineUsers() domain.UserList {
+	if len(c.connections) == 1 && len(c.connections[0].name) == 0 {
+		return c.connections[0].onlineUsers()
+	}
+	var users []*domain.User
+	for _, cc := range c.connections {
+		users = append(users, cc.qualifyAll(cc.users.all())...)
+	}
+	return domain.ImmutableUserList(domain.NewUserList(users...))
+}
+
+// route finds the connection m must be sent to, the one its dispatcher addressed it to or else the first one,
+// and returns m as that connection must receive it. Messages to unnamed or unknown connections are returned as they are
+func (c *Connector) route(m *domain.ClientMessage) (*chatConnection, *domain.ClientMessage) {
+	if len(c.connections[0].name) == 0 {
+		return c.connections[0], m
+	}
+	name, routed := connection.Destination(m)
+	for _, cc := range c.connections {
+		if len(cc.name) > 0 && cc.name == name {
+			return cc, routed
+		}
+	}
+	return c.connections[0], m
+}
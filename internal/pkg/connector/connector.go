@@ -2,33 +2,51 @@ package connector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/raf924/bot/v2/pkg"
 	"github.com/raf924/bot/v2/pkg/command"
 	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/connector-sdk/rpc"
 	"github.com/segmentio/ksuid"
-	"log"
+	"io"
+	"log/slog"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
-var helpCommand = domain.NewCommand("help", []string{"h"}, "help")
-
 type Connector struct {
-	config          connector.Config
-	dispatchers     sync.Map
-	connectionRelay rpc.ConnectionRelay
-	relayServer     rpc.ConnectorRelay
-	context         context.Context
-	cancelFunc      func(err error)
-	users           domain.UserList
+	config        connector.Config
+	dispatchers   dispatcherRegistry
+	connections   []*chatConnection
+	bridge        *bridge
+	rosterM       sync.Mutex
+	authenticator dispatch.Authenticator
+	relayServer   rpc.ConnectorRelay
+	admittedM     sync.Mutex
+	// admitted maps the dispatchers vetted by admission to their entries until the relay accepts them
+	admitted   map[rpc.Dispatcher]*dispatcherEntry
+	context    context.Context
+	cancelFunc func(err error)
+	startedAt  time.Time
+	logger     *slog.Logger
+	stopping   int32
+	// sending counts the messages being sent to a connection without going through its rate limiter
+	sending          int32
+	callbacksM       sync.RWMutex
+	onDispatcherJoin func(id string, dispatcher rpc.Dispatcher)
+	onDispatcherLeft func(id string, dispatcher rpc.Dispatcher)
 }
 
 var _ pkg.Runnable = (*Connector)(nil)
+var _ pkg.Stopper = (*Connector)(nil)
 
 func (c *Connector) Done() <-chan struct{} {
 	return c.context.Done()
@@ -38,90 +56,140 @@ func (c *Connector) Err() error {
 	return c.context.Err()
 }
 
-func (c *Connector) getCommandOr(mP *domain.ChatMessage) domain.ServerMessage {
-	log.Printf("Message from %s: %s\n", mP.Sender().Nick(), mP.Message())
-	if len(c.config.Trigger) == 0 {
-		return mP
+// getCommandOr parses mP, received from cc, into a command message along with the dispatchers it must be sent to, nil meaning every dispatcher.
+// It returns a nil message when the connector handled mP itself
+func (c *Connector) getCommandOr(cc *chatConnection, mP *domain.ChatMessage) (domain.ServerMessage, []*dispatcherEntry) {
+	c.logger.Debug("message received", "connection", cc.name, logging.UserKey, mP.Sender().Id(), logging.Content(c.config.Log, mP.Message()))
+	trigger := cc.trigger
+	if len(trigger) == 0 {
+		return cc.qualifyMessage(mP), nil
 	}
-	if !strings.HasPrefix(mP.Message(), c.config.Trigger) {
-		return mP
+	if !strings.HasPrefix(mP.Message(), trigger) {
+		return cc.qualifyMessage(mP), nil
 	}
-	argString := strings.TrimPrefix(mP.Message(), c.config.Trigger)
-	args := strings.Split(argString, " ")
-	if len(args) == 0 || len(args[0]) == 0 {
-		return mP
+	argString := strings.TrimPrefix(mP.Message(), trigger)
+	if len(argString) == 0 || unicode.IsSpace([]rune(argString)[0]) {
+		return cc.qualifyMessage(mP), nil
 	}
-	possibleCommand := args[0]
-	commands := domain.NewCommandList()
-	c.dispatchers.Range(func(key, value interface{}) bool {
-		commands.Append(value.(rpc.Dispatcher).Commands())
-		return true
-	})
-	if command.Is(possibleCommand, helpCommand) {
-		var names []string
-		for _, cmd := range commands.All() {
-			names = append(names, fmt.Sprintf("%s%s", c.config.Trigger, cmd.Name()))
-			for _, alias := range append(cmd.Aliases()) {
-				names = append(names, fmt.Sprintf("%s%s (%s)", c.config.Trigger, alias, cmd.Name()))
+	possibleCommand := strings.FieldsFunc(argString, unicode.IsSpace)[0]
+	builtin := c.findBuiltin(possibleCommand)
+	var cmd *domain.Command
+	var owners []*dispatcherEntry
+	if builtin == nil {
+		cmd, owners = c.resolve(possibleCommand)
+		if cmd == nil {
+			c.suggest(cc, mP, trigger, possibleCommand)
+			return cc.qualifyMessage(mP), nil
+		}
+	}
+	argString = strings.TrimSpace(strings.TrimPrefix(argString, possibleCommand))
+	args, err := command.Tokenize(argString)
+	if err != nil {
+		c.reply(cc, mP, fmt.Sprintf("%s%s: %v", trigger, possibleCommand, err))
+		return nil, nil
+	}
+	switch builtin {
+	case helpCommand:
+		c.reply(cc, mP, c.help(trigger, args))
+		return nil, nil
+	case moreCommand:
+		for _, message := range c.more(cc, mP) {
+			if err := c.deliver(cc, message); err != nil {
+				c.cancelFunc(err)
 			}
 		}
-		sort.Strings(names)
-		err := c.sendToConnection(domain.NewClientMessage(strings.Join(names, ", "), mP.Sender(), mP.Private()))
-		if err != nil {
-			c.cancelFunc(err)
+		return nil, nil
+	}
+	if len(owners) > 1 {
+		var alternatives []string
+		for _, owner := range owners {
+			alternatives = append(alternatives, fmt.Sprintf("%s%s:%s", trigger, owner.id, possibleCommand))
+		}
+		c.reply(cc, mP, fmt.Sprintf("%s%s is ambiguous, use one of %s", trigger, possibleCommand, strings.Join(alternatives, ", ")))
+		return nil, nil
+	}
+	commandsParsed.Inc(cmd.Name())
+	return domain.NewCommandMessage(cmd.Name(), args, argString, cc.qualify(mP.Sender()), mP.Private(), mP.Timestamp()), owners
+}
+
+// resolve finds the command called name and the dispatchers that own it according to the collision policy
+func (c *Connector) resolve(name string) (*domain.Command, []*dispatcherEntry) {
+	if c.config.Collisions == connector.Namespace {
+		if namespace, name, ok := strings.Cut(name, ":"); ok {
+			owner := c.dispatchers.get(namespace)
+			if owner == nil || owner.find(name) == nil {
+				return nil, nil
+			}
+			return owner.find(name), []*dispatcherEntry{owner}
 		}
-		return nil
 	}
-	cmd := commands.Find(possibleCommand)
-	if cmd == nil {
-		return mP
+	owners := c.dispatchers.owners(name)
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	if c.config.Collisions != connector.Namespace {
+		owners = owners[:1]
+	}
+	return owners[0].find(name), owners
+}
+
+// reply answers mP on the connection it came from
+func (c *Connector) reply(cc *chatConnection, mP *domain.ChatMessage, message string) {
+	err := c.sendTo(cc, domain.NewClientMessage(message, mP.Sender(), mP.Private()))
+	if err != nil {
+		c.cancelFunc(err)
 	}
-	argString = strings.TrimSpace(strings.TrimPrefix(argString, possibleCommand))
-	return domain.NewCommandMessage(cmd.Name(), args[1:], argString, mP.Sender(), mP.Private(), mP.Timestamp())
 }
 
 func (c *Connector) Start(ctx context.Context) error {
 	c.context, c.cancelFunc = pkg.Errorable(ctx)
-	c.connectionRelay.OnUserJoin(func(user *domain.User, timestamp time.Time) {
-		err := c.sendToDispatchers(domain.NewUserEvent(user, domain.UserJoined, timestamp))
+	c.startedAt = time.Now()
+	if err := c.config.Log.Validate(); err != nil {
+		return err
+	}
+	if err := validateConnections(c.connections); err != nil {
+		return err
+	}
+	if c.config.Bridge.Enabled {
+		bridge, err := newBridge(c.config.Bridge, c.connections)
 		if err != nil {
-			log.Println(err)
+			return err
 		}
-	})
-	c.connectionRelay.OnUserLeft(func(user *domain.User, timestamp time.Time) {
-		err := c.sendToDispatchers(domain.NewUserEvent(user, domain.UserLeft, timestamp))
-		if err != nil {
-			log.Println(err)
+		c.bridge = bridge
+	}
+	for _, cc := range c.connections {
+		if err := c.connect(cc); err != nil {
+			return err
 		}
-	})
-	u, users, err := c.connectionRelay.Connect(c.config.Name)
-	if err != nil {
-		return err
 	}
-	c.users = domain.ImmutableUserList(users)
-	if u == nil {
-		u = c.users.Find(c.config.Name)
+	if admitter, ok := c.relayServer.(dispatch.Admitter); ok {
+		admitter.SetAdmission(c.admission)
 	}
-	if u == nil {
-		return fmt.Errorf("couldn't find connector among users")
+	err := c.relayServer.Start(ctx, c.botUser(), c.onlineUsers(), c.config.Trigger)
+	if err != nil {
+		return err
 	}
-	err = c.relayServer.Start(ctx, u, c.users, c.config.Trigger)
+	err = c.serveStatus()
 	if err != nil {
 		return err
 	}
-	go func() {
-		for c.Err() == nil {
-			c.dispatchers.Range(func(key, value interface{}) bool {
-				select {
-				case <-value.(rpc.Dispatcher).Done():
-					c.dispatchers.Delete(key)
-					return false
-				default:
+	for _, cc := range c.connections {
+		if cc.rateLimiter.enabled() {
+			go func(cc *chatConnection) {
+				err := cc.rateLimiter.run(c.context, func(m *domain.ClientMessage) error {
+					return c.send(cc, m)
+				})
+				if err != nil && c.Err() == nil {
+					c.cancelFunc(err)
 				}
-				return true
-			})
+			}(cc)
 		}
-	}()
+		if c.bridge != nil {
+			go c.runBridge(cc)
+		}
+		go c.receive(cc)
+	}
+	go c.closeConnections()
 	go func() {
 		for c.Err() == nil {
 			dispatcher, err := c.relayServer.Accept()
@@ -129,77 +197,490 @@ func (c *Connector) Start(ctx context.Context) error {
 				c.cancelFunc(err)
 				return
 			}
-			newUUID, err := ksuid.NewRandom()
+			entry, err := c.entryOf(dispatcher)
 			if err != nil {
 				c.cancelFunc(err)
 				return
 			}
-			c.dispatchers.Store(newUUID.String(), dispatcher)
+			if c.isStopping() {
+				entry.disconnect(errStopping)
+				c.close(entry, errStopping)
+				continue
+			}
+			c.register(entry)
 		}
 	}()
 	go func() {
 		for c.Err() == nil {
-			mP, err := c.receiveFromConnection()
+			packet, err := c.receiveFromRelayServer()
 			if err != nil {
-				c.cancelFunc(err)
-				return
-			}
-			m := c.getCommandOr(mP)
-			if m == nil {
+				c.logger.Warn("couldn't receive from relay server", "error", err)
 				continue
 			}
-			err = c.sendToDispatchers(m)
+			err = c.sendToConnection(packet)
 			if err != nil {
-				log.Println(err)
+				c.cancelFunc(err)
+				return
 			}
 		}
 	}()
-	go func() {
-		for c.Err() == nil {
-			packet, err := c.receiveFromRelayServer()
-			if err != nil {
-				log.Println(err)
+	return nil
+}
+
+// closeConnections closes the relays of the connections that can be closed once the connector is done
+func (c *Connector) closeConnections() {
+	<-c.Done()
+	for _, cc := range c.connections {
+		if closer, ok := cc.relay.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				c.logger.Warn("couldn't close connection", "connection", cc.name, "error", err)
+			}
+		}
+	}
+}
+
+// connect connects cc to its chat service and forwards its user events to the dispatchers
+func (c *Connector) connect(cc *chatConnection) error {
+	cc.relay.OnUserJoin(func(user *domain.User, timestamp time.Time) {
+		c.announce(cc, user, domain.UserJoined)
+		err := c.userEvent(cc, user, domain.UserJoined, timestamp)
+		if err != nil {
+			c.logger.Warn("couldn't dispatch user event", "connection", cc.name, logging.UserKey, user.Id(), "error", err)
+		}
+	})
+	cc.relay.OnUserLeft(func(user *domain.User, timestamp time.Time) {
+		c.announce(cc, user, domain.UserLeft)
+		err := c.userEvent(cc, user, domain.UserLeft, timestamp)
+		if err != nil {
+			c.logger.Warn("couldn't dispatch user event", "connection", cc.name, logging.UserKey, user.Id(), "error", err)
+		}
+	})
+	u, users, err := cc.relay.Connect(c.config.Name)
+	if err != nil {
+		return err
+	}
+	cc.users.reset(users.All())
+	cc.setConnected(true)
+	if u == nil {
+		u = cc.users.find(c.config.Name)
+	}
+	if u == nil {
+		return fmt.Errorf("couldn't find connector among users of connection %q", cc.name)
+	}
+	cc.botUser = u
+	return nil
+}
+
+// botUser returns the connector's user on its first connection as the dispatchers see it
+func (c *Connector) botUser() *domain.User {
+	return c.connections[0].qualify(c.connections[0].botUser)
+}
+
+// receive dispatches the messages received from cc until the connector is done
+func (c *Connector) receive(cc *chatConnection) {
+	for c.Err() == nil {
+		generation := cc.connectionGeneration()
+		mP, err := cc.relay.Recv()
+		if err != nil {
+			err := c.recover(cc, generation, err)
+			if errors.Is(err, errReconnecting) {
+				cc.waitReconnection(c.context)
 				continue
 			}
-			err = c.sendToConnection(packet)
 			if err != nil {
 				c.cancelFunc(err)
 				return
 			}
+			continue
 		}
-	}()
+		messagesReceived.Inc()
+		if c.isStopping() {
+			continue
+		}
+		c.mirror(cc, mP)
+		m, recipients := c.getCommandOr(cc, mP)
+		if m == nil {
+			continue
+		}
+		err = c.sendToDispatchers(m, recipients...)
+		if err != nil {
+			c.logger.Warn("couldn't dispatch message", "connection", cc.name, "error", err)
+		}
+	}
+}
+
+func (c *Connector) isStopping() bool {
+	return atomic.LoadInt32(&c.stopping) == 1
+}
+
+// Stop ignores new chat messages and dispatchers, waits for the queued messages to be dispatched,
+// stops the relay server if it can be stopped and waits for the replies of its dispatchers to be sent.
+// It stops the connector once they are or when ctx is done
+func (c *Connector) Stop(ctx context.Context) error {
+	atomic.StoreInt32(&c.stopping, 1)
+	defer c.cancelFunc(pkg.ErrStopped)
+	if err := c.waitUntil(ctx, c.dispatched); err != nil {
+		return fmt.Errorf("couldn't dispatch pending messages: %w", err)
+	}
+	var err error
+	if stopper, ok := c.relayServer.(pkg.Stopper); ok {
+		err = stopper.Stop(ctx)
+	}
+	if err := c.waitUntil(ctx, c.sent); err != nil {
+		return fmt.Errorf("couldn't send pending messages: %w", err)
+	}
+	return err
+}
+
+// waitUntil polls done until it returns true or ctx is done
+func (c *Connector) waitUntil(ctx context.Context, done func() bool) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for !done() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 	return nil
 }
 
+// dispatched tells whether every queued message was dispatched
+func (c *Connector) dispatched() bool {
+	for _, entry := range c.dispatchers.all() {
+		if !entry.flushed() {
+			return false
+		}
+	}
+	return true
+}
+
+// sent tells whether every reply of the dispatchers was sent to its connection
+func (c *Connector) sent() bool {
+	if drainer, ok := c.relayServer.(pkg.Drainer); ok && drainer.Pending() > 0 {
+		return false
+	}
+	if atomic.LoadInt32(&c.sending) > 0 || (c.bridge != nil && c.bridge.pending() > 0) {
+		return false
+	}
+	for _, cc := range c.connections {
+		if cc.rateLimiter.pending() > 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *Connector) receiveFromRelayServer() (*domain.ClientMessage, error) {
 	return c.relayServer.Recv()
 }
 
-func (c *Connector) receiveFromConnection() (*domain.ChatMessage, error) {
-	return c.connectionRelay.Recv()
+var (
+	errDispatcherDone = errors.New("dispatcher is done")
+	errQueueFull      = errors.New("dispatcher queue is full")
+	errReplaced       = errors.New("replaced by a dispatcher with the same name")
+	errStopping       = errors.New("connector is stopping")
+)
+
+// rejected logs why entry was refused and returns the error its dispatcher must be closed with
+func (c *Connector) rejected(entry *dispatcherEntry, reason string, err error) error {
+	rejections.Inc(reason)
+	c.logger.Warn("dispatcher rejected", logging.DispatcherKey, entry.id, "reason", reason, "error", err)
+	if err == nil {
+		err = errors.New(reason)
+	}
+	return fmt.Errorf("rejected: %w", err)
 }
 
-func (c *Connector) sendToDispatchers(m domain.ServerMessage) error {
-	c.dispatchers.Range(func(key, value interface{}) bool {
-		go func() {
-			err := value.(rpc.Dispatcher).Dispatch(m)
-			if err != nil {
-				log.Println(err)
-			}
-		}()
-		return true
-	})
+// reject logs why entry was refused and closes it
+func (c *Connector) reject(entry *dispatcherEntry, reason string, err error) {
+	c.close(entry, c.rejected(entry, reason, err))
+}
+
+// close ends the session of entry's dispatcher, or tells it it was dropped if its relay can't end it and it understands Disconnection
+func (c *Connector) close(entry *dispatcherEntry, reason error) {
+	var err error
+	if closer, ok := entry.dispatcher.(dispatch.Closer); ok {
+		err = closer.Close(reason)
+	} else if entry.handshake.ConnectorMessages {
+		err = entry.dispatcher.Dispatch(dispatch.NewDisconnection(reason, time.Now()))
+	}
+	if err != nil {
+		c.logger.Warn("couldn't close dispatcher", logging.DispatcherKey, entry.id, "error", err)
+	}
+}
+
+func (c *Connector) newEntry(dispatcher rpc.Dispatcher) (*dispatcherEntry, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	return newDispatcherEntry(c.context, id.String(), dispatcher, c.config.Dispatch.QueueSize), nil
+}
+
+// vet reads the handshake of entry and checks it, it returns why entry is rejected if it fails a check
+func (c *Connector) vet(entry *dispatcherEntry) (string, error) {
+	if err := entry.readHandshake(); err != nil {
+		return "invalid handshake", err
+	}
+	if c.authenticator != nil {
+		if err := c.authenticator.Authenticate(entry.handshake, entry.commands); err != nil {
+			return "authentication", err
+		}
+	}
+	if err := entry.identify(); err != nil {
+		return "invalid name", err
+	}
+	if err := entry.subscribe(); err != nil {
+		return "invalid subscription", err
+	}
+	entry.vetted = true
+	return "", nil
+}
+
+// collide rejects entry if it registers a command that is already registered and newcomers must be rejected
+func (c *Connector) collide(entry *dispatcherEntry) (string, error) {
+	if c.config.Collisions != connector.RejectNewcomer {
+		return "", nil
+	}
+	collisions := c.dispatchers.collisions(entry)
+	if len(collisions) == 0 {
+		return "", nil
+	}
+	var names []string
+	for name := range collisions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "command collision", fmt.Errorf("already registered: %s", strings.Join(names, ", "))
+}
+
+// admission vets a dispatcher before its relay accepts it, the entry it admits is registered once the relay accepts the dispatcher
+func (c *Connector) admission(dispatcher rpc.Dispatcher) error {
+	if c.isStopping() {
+		return errStopping
+	}
+	entry, err := c.newEntry(dispatcher)
+	if err != nil {
+		return err
+	}
+	reason, err := c.vet(entry)
+	if len(reason) == 0 {
+		reason, err = c.collide(entry)
+	}
+	if len(reason) > 0 {
+		entry.disconnect(nil)
+		return c.rejected(entry, reason, err)
+	}
+	c.admittedM.Lock()
+	c.admitted[dispatcher] = entry
+	c.admittedM.Unlock()
 	return nil
 }
 
+// entryOf returns the entry admitted for dispatcher, or a new one if it wasn't admitted
+func (c *Connector) entryOf(dispatcher rpc.Dispatcher) (*dispatcherEntry, error) {
+	c.admittedM.Lock()
+	entry, ok := c.admitted[dispatcher]
+	delete(c.admitted, dispatcher)
+	c.admittedM.Unlock()
+	if ok {
+		return entry, nil
+	}
+	return c.newEntry(dispatcher)
+}
+
+// register adds entry once it is vetted, unless it was already, and checked against the dispatchers registered since
+func (c *Connector) register(entry *dispatcherEntry) {
+	var reason string
+	var err error
+	if !entry.vetted {
+		reason, err = c.vet(entry)
+	}
+	if len(reason) == 0 {
+		reason, err = c.collide(entry)
+	}
+	if len(reason) > 0 {
+		c.reject(entry, reason, err)
+		return
+	}
+	for name, owners := range c.dispatchers.collisions(entry) {
+		for _, owner := range owners {
+			c.logger.Warn("command collision", logging.DispatcherKey, entry.id, logging.CommandKey, name, "owner", owner.id)
+		}
+	}
+	if previous := c.dispatchers.get(entry.id); previous != nil {
+		c.replace(previous, entry)
+	}
+	c.rosterM.Lock()
+	c.dispatchers.add(entry)
+	go entry.run(c.logger)
+	err = c.sendRoster(entry)
+	c.rosterM.Unlock()
+	if err != nil {
+		c.logger.Warn("couldn't send the online users", logging.DispatcherKey, entry.id, "error", err)
+	}
+	dispatcherCount.Set(float64(c.dispatchers.len()))
+	c.logger.Info("dispatcher joined", logging.DispatcherKey, entry.id, "version", entry.version)
+	c.dispatcherJoined(entry)
+	go c.watch(entry)
+}
+
+// replace disconnects and closes previous, a dispatcher with the same name as entry
+func (c *Connector) replace(previous *dispatcherEntry, entry *dispatcherEntry) {
+	previous.disconnect(errReplaced)
+	if !c.dispatchers.remove(previous) {
+		return
+	}
+	c.logger.Info("dispatcher replaced", logging.DispatcherKey, entry.id, "previousVersion", previous.version, "version", entry.version)
+	c.close(previous, errReplaced)
+	c.dispatcherLeft(previous)
+}
+
+// watch removes entry once its dispatcher is done or it has been disconnected
+func (c *Connector) watch(entry *dispatcherEntry) {
+	left := false
+	select {
+	case <-entry.dispatcher.Done():
+		left = true
+	case <-entry.ctx.Done():
+		if c.Err() != nil {
+			return
+		}
+	}
+	entry.disconnect(errDispatcherDone)
+	if !c.dispatchers.remove(entry) {
+		// entry was replaced by a dispatcher with the same name
+		return
+	}
+	if left {
+		c.logger.Info("dispatcher left", logging.DispatcherKey, entry.id, "error", entry.dispatcher.Err())
+	} else {
+		reason := context.Cause(entry.ctx)
+		c.logger.Warn("dispatcher disconnected", logging.DispatcherKey, entry.id, "reason", reason)
+		c.close(entry, reason)
+	}
+	dispatcherCount.Set(float64(c.dispatchers.len()))
+	c.dispatcherLeft(entry)
+}
+
+// SetAuthenticator replaces the authenticator built from the configured tokens. It must be called before Start
+func (c *Connector) SetAuthenticator(authenticator dispatch.Authenticator) {
+	c.authenticator = authenticator
+}
+
+// OnDispatcherJoin registers a callback called whenever a dispatcher is accepted
+func (c *Connector) OnDispatcherJoin(f func(id string, dispatcher rpc.Dispatcher)) {
+	c.callbacksM.Lock()
+	c.onDispatcherJoin = f
+	c.callbacksM.Unlock()
+}
+
+// OnDispatcherLeft registers a callback called whenever a dispatcher is done
+func (c *Connector) OnDispatcherLeft(f func(id string, dispatcher rpc.Dispatcher)) {
+	c.callbacksM.Lock()
+	c.onDispatcherLeft = f
+	c.callbacksM.Unlock()
+}
+
+func (c *Connector) dispatcherJoined(entry *dispatcherEntry) {
+	c.callbacksM.RLock()
+	f := c.onDispatcherJoin
+	c.callbacksM.RUnlock()
+	if f != nil {
+		f(entry.id, entry.registered())
+	}
+}
+
+func (c *Connector) dispatcherLeft(entry *dispatcherEntry) {
+	c.callbacksM.RLock()
+	f := c.onDispatcherLeft
+	c.callbacksM.RUnlock()
+	if f != nil {
+		f(entry.id, entry.registered())
+	}
+}
+
+// sendToDispatchers queues m for recipients or for every dispatcher when there are none, skipping those that didn't subscribe to it
+func (c *Connector) sendToDispatchers(m domain.ServerMessage, recipients ...*dispatcherEntry) error {
+	if len(recipients) == 0 {
+		recipients = c.dispatchers.all()
+	}
+	for _, entry := range recipients {
+		if !entry.accepts(m) {
+			continue
+		}
+		if !entry.enqueue(m, c.config.Dispatch.Overflow) {
+			c.logger.Warn("dispatcher queue is full", logging.DispatcherKey, entry.id)
+			entry.disconnect(errQueueFull)
+		}
+	}
+	return nil
+}
+
+// QueueDepths returns the number of messages waiting to be dispatched to each dispatcher
+func (c *Connector) QueueDepths() map[string]int {
+	depths := map[string]int{}
+	for _, entry := range c.dispatchers.all() {
+		depths[entry.id] = entry.depth()
+	}
+	return depths
+}
+
+// sendToConnection sends m to the connection its recipient belongs to
 func (c *Connector) sendToConnection(m *domain.ClientMessage) error {
-	return c.connectionRelay.Send(m)
+	cc, m := c.route(m)
+	return c.sendTo(cc, m)
 }
 
-func NewConnector(config connector.Config, connection rpc.ConnectionRelay, connectorRelay rpc.ConnectorRelay) *Connector {
-	return &Connector{
-		config:          config,
-		connectionRelay: connection,
-		relayServer:     connectorRelay,
+func (c *Connector) sendTo(cc *chatConnection, m *domain.ClientMessage) error {
+	for _, message := range c.split(cc, m) {
+		if err := c.deliver(cc, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver sends m to cc, through its rate limiter if there is one
+func (c *Connector) deliver(cc *chatConnection, m *domain.ClientMessage) error {
+	if cc.rateLimiter.enabled() {
+		cc.rateLimiter.push(m)
+		return nil
+	}
+	atomic.AddInt32(&c.sending, 1)
+	defer atomic.AddInt32(&c.sending, -1)
+	return c.send(cc, m)
+}
+
+// RateLimitStats tells how often outgoing messages were delayed, dropped or coalesced by the rate limiters
+func (c *Connector) RateLimitStats() RateLimitStats {
+	var stats RateLimitStats
+	for _, cc := range c.connections {
+		connectionStats := cc.rateLimiter.stats()
+		stats.Throttled += connectionStats.Throttled
+		stats.Dropped += connectionStats.Dropped
+		stats.Coalesced += connectionStats.Coalesced
+	}
+	return stats
+}
+
+func NewConnector(config connector.Config, connection rpc.ConnectionRelay, connectorRelay rpc.ConnectorRelay, logger *slog.Logger) *Connector {
+	return NewMultiConnector(config, []Connection{{Relay: connection}}, connectorRelay, logger)
+}
+
+// NewMultiConnector returns a Connector serving every connection to the same dispatchers
+func NewMultiConnector(config connector.Config, connections []Connection, connectorRelay rpc.ConnectorRelay, logger *slog.Logger) *Connector {
+	c := &Connector{
+		logger:        logging.OrDefault(logger),
+		config:        config,
+		relayServer:   connectorRelay,
+		authenticator: newTokenAuthenticator(config.Auth),
+		admitted:      map[rpc.Dispatcher]*dispatcherEntry{},
+	}
+	for _, conn := range connections {
+		c.connections = append(c.connections, newChatConnection(config, conn))
 	}
+	return c
 }
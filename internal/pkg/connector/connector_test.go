@@ -2,11 +2,26 @@ package connector
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	internalRpc "github.com/raf924/bot/v2/internal/pkg/rpc"
 	"github.com/raf924/bot/v2/pkg"
+	"github.com/raf924/bot/v2/pkg/command"
 	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
 	"github.com/raf924/queue"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -16,18 +31,32 @@ type dummyConnection struct {
 	chatMessageConsumer   queue.Consumer[*domain.ChatMessage]
 	clientMessageProducer queue.Producer[*domain.ClientMessage]
 	botUser               *domain.User
+	recvErrors            chan error
+	connectErrors         chan error
+	connects              int64
+	onUserJoin            func(user *domain.User, timestamp time.Time)
+	// sends blocks Send until it can be received from when it isn't nil
+	sends chan struct{}
 }
 
 func (d *dummyConnection) Recv() (*domain.ChatMessage, error) {
+	select {
+	case err := <-d.recvErrors:
+		return nil, err
+	default:
+	}
 	return d.chatMessageConsumer.Consume(context.Background())
 }
 
 func (d *dummyConnection) Send(message *domain.ClientMessage) error {
+	if d.sends != nil {
+		<-d.sends
+	}
 	return d.clientMessageProducer.Produce(message)
 }
 
-func (d *dummyConnection) OnUserJoin(func(user *domain.User, timestamp time.Time)) {
-
+func (d *dummyConnection) OnUserJoin(f func(user *domain.User, timestamp time.Time)) {
+	d.onUserJoin = f
 }
 
 func (d *dummyConnection) OnUserLeft(func(user *domain.User, timestamp time.Time)) {
@@ -35,6 +64,12 @@ func (d *dummyConnection) OnUserLeft(func(user *domain.User, timestamp time.Time
 }
 
 func (d *dummyConnection) Connect(nick string) (*domain.User, domain.UserList, error) {
+	atomic.AddInt64(&d.connects, 1)
+	select {
+	case err := <-d.connectErrors:
+		return nil, nil, err
+	default:
+	}
 	return domain.NewUser(nick, "", domain.RegularUser), d.users, nil
 }
 
@@ -81,6 +116,7 @@ func TestConnector(t *testing.T) {
 	botUser := domain.NewOnlineUser("bot", "id", domain.RegularUser, time.Now())
 	crRelay := internalRpc.NewDefaultConnectorRelay(
 		&dummyRunnable{ctx: ctx},
+		internalRpc.NewRegistration(),
 		clientMessageConsumer,
 		serverMessageProducer,
 	)
@@ -90,17 +126,25 @@ func TestConnector(t *testing.T) {
 		chatMessageConsumer:   chatMessageConsumer,
 		clientMessageProducer: clientMessageProducer,
 	}
-	ctr := NewConnector(connector.Config{}, cnRelay, crRelay)
+	ctr := NewConnector(connector.Config{}, cnRelay, crRelay, nil)
 	err = ctr.Start(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
+	(&connectorHarness{connector: ctr}).waitForDispatchers(t, 1)
 	message := domain.NewChatMessage("hello", botUser, nil, false, false, time.Now(), true)
 	err = chatMessageProducer.Produce(message)
 	if err != nil {
 		t.Fatal(err)
 	}
+	// the relay presents no handshake, so the online users come first as UserJoined events
 	consume, err := serverMessageConsumer.Consume(context.Background())
+	for err == nil {
+		if _, ok := consume.(*domain.UserEvent); !ok {
+			break
+		}
+		consume, err = serverMessageConsumer.Consume(context.Background())
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -108,3 +152,1133 @@ func TestConnector(t *testing.T) {
 		t.Fatal("expected", message, "got", consume)
 	}
 }
+
+type dummyDispatcher struct {
+	ctx       context.Context
+	commands  domain.CommandList
+	messages  chan domain.ServerMessage
+	doneCalls int64
+	closed    chan error
+}
+
+func (d *dummyDispatcher) Close(reason error) error {
+	select {
+	case d.closed <- reason:
+	default:
+	}
+	return nil
+}
+
+// expectClosed waits for the connector to close dispatcher
+func expectClosed(t *testing.T, dispatcher *dummyDispatcher) error {
+	t.Helper()
+	select {
+	case reason := <-dispatcher.closed:
+		return reason
+	case <-time.After(time.Second):
+		t.Fatal("expected the dispatcher to be closed")
+	}
+	return nil
+}
+
+func (d *dummyDispatcher) Dispatch(message domain.ServerMessage) error {
+	d.messages <- message
+	return nil
+}
+
+func (d *dummyDispatcher) Commands() domain.CommandList {
+	return d.commands
+}
+
+func (d *dummyDispatcher) Done() <-chan struct{} {
+	atomic.AddInt64(&d.doneCalls, 1)
+	return d.ctx.Done()
+}
+
+func (d *dummyDispatcher) Err() error {
+	return d.ctx.Err()
+}
+
+// newDummyDispatcher returns a dispatcher registering commands that understands the connector's own messages
+func newDummyDispatcher(ctx context.Context, commands ...*domain.Command) *dummyDispatcher {
+	registration, err := dispatch.Handshake{ConnectorMessages: true}.Registration(commands)
+	if err != nil {
+		panic(err)
+	}
+	return newSdkDispatcher(ctx, registration.Commands()...)
+}
+
+// newSdkDispatcher returns a dispatcher registering commands without a handshake, it only understands the SDK's messages
+func newSdkDispatcher(ctx context.Context, commands ...*domain.Command) *dummyDispatcher {
+	return &dummyDispatcher{
+		ctx:      ctx,
+		commands: domain.NewCommandList(commands...),
+		messages: make(chan domain.ServerMessage, 16),
+		closed:   make(chan error, 1),
+	}
+}
+
+type dummyConnectorRelay struct {
+	ctx         context.Context
+	dispatchers chan rpc.Dispatcher
+}
+
+func (d *dummyConnectorRelay) Start(ctx context.Context, _ *domain.User, _ domain.UserList, _ string) error {
+	d.ctx = ctx
+	return nil
+}
+
+func (d *dummyConnectorRelay) Accept() (rpc.Dispatcher, error) {
+	select {
+	case dispatcher := <-d.dispatchers:
+		return dispatcher, nil
+	case <-d.ctx.Done():
+		return nil, d.ctx.Err()
+	}
+}
+
+func (d *dummyConnectorRelay) Recv() (*domain.ClientMessage, error) {
+	<-d.ctx.Done()
+	return nil, d.ctx.Err()
+}
+
+func (d *dummyConnectorRelay) Done() <-chan struct{} {
+	return d.ctx.Done()
+}
+
+func (d *dummyConnectorRelay) Err() error {
+	return d.ctx.Err()
+}
+
+type connectorHarness struct {
+	connection     *dummyConnection
+	chatMessages   queue.Producer[*domain.ChatMessage]
+	clientMessages queue.Consumer[*domain.ClientMessage]
+	relay          *dummyConnectorRelay
+	connector      *Connector
+	user           *domain.User
+}
+
+func newConnectionHarness(t *testing.T, user *domain.User) *connectorHarness {
+	clientMessageQueue := queue.NewQueue[*domain.ClientMessage]()
+	chatMessageQueue := queue.NewQueue[*domain.ChatMessage]()
+	clientMessageConsumer, err := clientMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatMessageConsumer, err := chatMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &connectorHarness{
+		connection: &dummyConnection{
+			users:                 domain.NewUserList(user),
+			chatMessageConsumer:   chatMessageConsumer,
+			clientMessageProducer: clientMessageQueue,
+			recvErrors:            make(chan error, 1),
+			connectErrors:         make(chan error, 8),
+		},
+		chatMessages:   chatMessageQueue,
+		clientMessages: clientMessageConsumer,
+		user:           user,
+	}
+}
+
+func newDummyConnectorRelay(dispatchers ...rpc.Dispatcher) *dummyConnectorRelay {
+	relay := &dummyConnectorRelay{dispatchers: make(chan rpc.Dispatcher, len(dispatchers))}
+	for _, dispatcher := range dispatchers {
+		relay.dispatchers <- dispatcher
+	}
+	return relay
+}
+
+func startConnector(t *testing.T, config connector.Config, dispatchers ...rpc.Dispatcher) *connectorHarness {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	h := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	h.relay = newDummyConnectorRelay(dispatchers...)
+	h.connector = NewConnector(config, h.connection, h.relay, nil)
+	if err := h.connector.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForDispatchers(t, len(dispatchers))
+	return h
+}
+
+func (h *connectorHarness) waitForDispatchers(t *testing.T, count int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if h.connector.dispatchers.len() == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d dispatchers", count)
+}
+
+func (h *connectorHarness) say(t *testing.T, message string) {
+	err := h.chatMessages.Produce(domain.NewChatMessage(message, h.user, nil, false, false, time.Now(), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (h *connectorHarness) expectReply(t *testing.T, expected string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := h.clientMessages.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message() != expected {
+		t.Fatalf("expected %q got %q", expected, reply.Message())
+	}
+}
+
+func isRoster(message domain.ServerMessage) bool {
+	_, ok := message.(*connection.Roster)
+	return ok
+}
+
+// expectDispatched returns the next message dispatched to dispatcher, skipping the snapshot of the online users
+func expectDispatched(t *testing.T, dispatcher *dummyDispatcher) domain.ServerMessage {
+	for {
+		select {
+		case message := <-dispatcher.messages:
+			if isRoster(message) {
+				continue
+			}
+			return message
+		case <-time.After(time.Second):
+			t.Fatal("expected a message to be dispatched")
+		}
+		return nil
+	}
+}
+
+func TestConnector_Help(t *testing.T) {
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("remind", []string{"r"}, command.FormatUsage("remind <what> <when>", "Reminds you of something")))
+	h := startConnector(t, connector.Config{Trigger: "!"}, dispatcher)
+	h.say(t, "!help remind")
+	h.expectReply(t, "Usage: !remind <what> <when>\nReminds you of something\nAliases: !r")
+	h.say(t, "!help nope")
+	h.expectReply(t, "Unknown command !nope")
+}
+
+func TestConnector_QuotedArguments(t *testing.T) {
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("remind", nil, "remind"))
+	h := startConnector(t, connector.Config{Trigger: "!"}, dispatcher)
+	h.say(t, `!remind  "buy milk"   10m`)
+	message, ok := expectDispatched(t, dispatcher).(*domain.CommandMessage)
+	if !ok {
+		t.Fatal("expected a command message")
+	}
+	if args := message.Args(); len(args) != 2 || args[0] != "buy milk" || args[1] != "10m" {
+		t.Fatalf("unexpected args %q", args)
+	}
+	h.say(t, `!remind "buy milk 10m`)
+	h.expectReply(t, "!remind: unbalanced quotes: missing closing \"")
+}
+
+func TestConnector_RoutesCommandsToOwner(t *testing.T) {
+	owner := newDummyDispatcher(context.Background(), domain.NewCommand("remind", nil, "remind"))
+	other := newDummyDispatcher(context.Background(), domain.NewCommand("echo", nil, "echo"))
+	h := startConnector(t, connector.Config{Trigger: "!"}, owner, other)
+	h.say(t, "!remind me")
+	if _, ok := expectDispatched(t, owner).(*domain.CommandMessage); !ok {
+		t.Fatal("expected the owner to receive the command")
+	}
+	h.say(t, "hello")
+	expectDispatched(t, owner)
+	if message := expectDispatched(t, other); message.(*domain.ChatMessage).Message() != "hello" {
+		t.Fatal("expected other dispatcher to only receive the chat message, got", message)
+	}
+}
+
+func TestConnector_Collisions(t *testing.T) {
+	newDispatchers := func() (*dummyDispatcher, *dummyDispatcher) {
+		return newDummyDispatcher(context.Background(), domain.NewCommand("remind", []string{"r"}, "remind")),
+			newDummyDispatcher(context.Background(), domain.NewCommand("roll", []string{"r"}, "roll"))
+	}
+	t.Run("first wins", func(t *testing.T) {
+		first, second := newDispatchers()
+		h := startConnector(t, connector.Config{Trigger: "!"}, first)
+		h.relay.dispatchers <- second
+		h.waitForDispatchers(t, 2)
+		h.say(t, "!r")
+		if message := expectDispatched(t, first).(*domain.CommandMessage); message.Command() != "remind" {
+			t.Fatal("expected remind got", message.Command())
+		}
+	})
+	t.Run("reject newcomer", func(t *testing.T) {
+		first, second := newDispatchers()
+		h := startConnector(t, connector.Config{Trigger: "!", Collisions: connector.RejectNewcomer}, first)
+		h.relay.dispatchers <- second
+		expectClosed(t, second)
+		if n := h.connector.dispatchers.len(); n != 1 {
+			t.Fatalf("expected the newcomer to be rejected, got %d dispatchers", n)
+		}
+	})
+	t.Run("namespace", func(t *testing.T) {
+		first, second := newDispatchers()
+		h := startConnector(t, connector.Config{Trigger: "!", Collisions: connector.Namespace}, first)
+		h.relay.dispatchers <- second
+		h.waitForDispatchers(t, 2)
+		entries := h.connector.dispatchers.all()
+		h.say(t, "!r")
+		h.expectReply(t, fmt.Sprintf("!r is ambiguous, use one of !%s:r, !%s:r", entries[0].id, entries[1].id))
+		h.say(t, fmt.Sprintf("!%s:r 1d6", entries[1].id))
+		if message := expectDispatched(t, second).(*domain.CommandMessage); message.Command() != "roll" {
+			t.Fatal("expected roll got", message.Command())
+		}
+		help := h.connector.help("!", nil)
+		if !strings.Contains(help, fmt.Sprintf("Ambiguous: !r (%s, %s)", entries[0].id, entries[1].id)) {
+			t.Fatal("expected help to list ambiguous names, got", help)
+		}
+	})
+}
+
+func TestConnector_DispatcherLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	registration, err := dispatch.Handshake{Token: "secret"}.Registration([]*domain.Command{domain.NewCommand("remind", nil, "remind")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := newSdkDispatcher(ctx, registration.Commands()...)
+	h := startConnector(t, connector.Config{Trigger: "!"})
+	joined := make(chan string, 1)
+	left := make(chan string, 1)
+	h.connector.OnDispatcherJoin(func(id string, dispatcher rpc.Dispatcher) {
+		if dispatcher.Commands().Find(dispatch.HandshakeCommand) != nil {
+			t.Error("expected the callbacks not to see the handshake")
+		}
+		joined <- id
+	})
+	h.connector.OnDispatcherLeft(func(id string, _ rpc.Dispatcher) {
+		left <- id
+	})
+	h.relay.dispatchers <- dispatcher
+	id := <-joined
+	time.Sleep(100 * time.Millisecond)
+	if calls := atomic.LoadInt64(&dispatcher.doneCalls); calls > 2 {
+		t.Fatalf("expected the connector to wait on Done, it was polled %d times", calls)
+	}
+	cancel()
+	select {
+	case leftId := <-left:
+		if leftId != id {
+			t.Fatalf("expected %s to leave, got %s", id, leftId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the dispatcher to leave")
+	}
+	if n := h.connector.dispatchers.len(); n != 0 {
+		t.Fatalf("expected no dispatcher, got %d", n)
+	}
+}
+
+func TestDispatcherEntry_Overflow(t *testing.T) {
+	chat := func(i int) domain.ServerMessage {
+		return domain.NewChatMessage(fmt.Sprint(i), nil, nil, false, false, time.Now(), true)
+	}
+	t.Run("keeps order", func(t *testing.T) {
+		dispatcher := newDummyDispatcher(context.Background())
+		entry := newDispatcherEntry(context.Background(), "id", dispatcher, 16)
+		t.Cleanup(func() { entry.disconnect(nil) })
+		go entry.run(slog.Default())
+		for i := 0; i < 16; i++ {
+			entry.enqueue(chat(i), connector.Block)
+		}
+		for i := 0; i < 16; i++ {
+			if message := expectDispatched(t, dispatcher).(*domain.ChatMessage); message.Message() != fmt.Sprint(i) {
+				t.Fatalf("expected %d got %s", i, message.Message())
+			}
+		}
+	})
+	t.Run("drop oldest", func(t *testing.T) {
+		entry := newDispatcherEntry(context.Background(), "id", newDummyDispatcher(context.Background()), 2)
+		for i := 0; i < 5; i++ {
+			if !entry.enqueue(chat(i), connector.DropOldest) {
+				t.Fatal("expected the message to be queued")
+			}
+		}
+		if entry.depth() != 2 || atomic.LoadInt64(&entry.dropped) != 3 {
+			t.Fatalf("expected 2 queued and 3 dropped messages, got %d and %d", entry.depth(), entry.dropped)
+		}
+		if message := (<-entry.outbox).(*domain.ChatMessage); message.Message() != "3" {
+			t.Fatal("expected the oldest messages to be dropped, got", message.Message())
+		}
+	})
+	t.Run("disconnect", func(t *testing.T) {
+		entry := newDispatcherEntry(context.Background(), "id", newDummyDispatcher(context.Background()), 1)
+		if !entry.enqueue(chat(0), connector.Disconnect) {
+			t.Fatal("expected the message to be queued")
+		}
+		if entry.enqueue(chat(1), connector.Disconnect) {
+			t.Fatal("expected a full queue to disconnect the dispatcher")
+		}
+	})
+}
+
+func TestConnector_DisconnectsSlowDispatcher(t *testing.T) {
+	slow := newDummyDispatcher(context.Background())
+	slow.messages = make(chan domain.ServerMessage)
+	h := startConnector(t, connector.Config{Dispatch: connector.DispatchConfig{QueueSize: 1, Overflow: connector.Disconnect}}, slow)
+	for i := 0; i < 3; i++ {
+		h.say(t, fmt.Sprint(i))
+	}
+	h.waitForDispatchers(t, 0)
+	if reason := expectClosed(t, slow); !errors.Is(reason, errQueueFull) {
+		t.Fatal("expected the dispatcher to be closed because of its queue, got", reason)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	alice := domain.NewUser("alice", "alice", domain.RegularUser)
+	bob := domain.NewUser("bob", "bob", domain.RegularUser)
+	expectNext := func(t *testing.T, limiter *rateLimiter, now time.Time, message string, wait time.Duration) {
+		t.Helper()
+		m, gotWait := limiter.next(now)
+		got := ""
+		if m != nil {
+			got = m.Message()
+		}
+		if got != message || gotWait != wait {
+			t.Fatalf("expected %q after %s, got %q after %s", message, wait, got, gotWait)
+		}
+	}
+	t.Run("recipients don't block each other", func(t *testing.T) {
+		now := time.Now()
+		limiter := newRateLimiter(connector.RateLimitConfig{
+			Global:       connector.RateConfig{Rate: 10, Burst: 3},
+			PerRecipient: connector.RateConfig{Rate: 1},
+		})
+		limiter.push(domain.NewClientMessage("a1", alice, true))
+		limiter.push(domain.NewClientMessage("a2", alice, true))
+		limiter.push(domain.NewClientMessage("b1", bob, true))
+		expectNext(t, limiter, now, "a1", 0)
+		expectNext(t, limiter, now, "b1", 0)
+		expectNext(t, limiter, now, "", time.Second)
+		expectNext(t, limiter, now.Add(time.Second), "a2", 0)
+		if stats := limiter.stats(); stats.Throttled != 1 {
+			t.Fatalf("expected 1 throttled message, got %+v", stats)
+		}
+	})
+	t.Run("global limit", func(t *testing.T) {
+		now := time.Now()
+		limiter := newRateLimiter(connector.RateLimitConfig{Global: connector.RateConfig{Rate: 10}})
+		limiter.push(domain.NewClientMessage("1", alice, true))
+		limiter.push(domain.NewClientMessage("2", bob, true))
+		expectNext(t, limiter, now, "1", 0)
+		expectNext(t, limiter, now, "", 100*time.Millisecond)
+		expectNext(t, limiter, now.Add(100*time.Millisecond), "2", 0)
+	})
+	t.Run("overflow", func(t *testing.T) {
+		for _, tt := range []struct {
+			policy connector.ThrottlePolicy
+			queued []string
+			stats  RateLimitStats
+		}{
+			{policy: connector.DropExcess, queued: []string{"1", "2"}, stats: RateLimitStats{Dropped: 2}},
+			{policy: connector.Coalesce, queued: []string{"1\n3", "2"}, stats: RateLimitStats{Coalesced: 1, Dropped: 1}},
+		} {
+			limiter := newRateLimiter(connector.RateLimitConfig{Global: connector.RateConfig{Rate: 1}, QueueSize: 2, Overflow: tt.policy})
+			limiter.push(domain.NewClientMessage("1", alice, true))
+			limiter.push(domain.NewClientMessage("2", bob, true))
+			limiter.push(domain.NewClientMessage("3", alice, true))
+			limiter.push(domain.NewEmote("4"))
+			var queued []string
+			for _, m := range limiter.queue {
+				queued = append(queued, m.Message())
+			}
+			if strings.Join(queued, ",") != strings.Join(tt.queued, ",") {
+				t.Errorf("%s: expected %q queued, got %q", tt.policy, tt.queued, queued)
+			}
+			if limiter.stats() != tt.stats {
+				t.Errorf("%s: expected %+v got %+v", tt.policy, tt.stats, limiter.stats())
+			}
+		}
+	})
+}
+
+func TestConnector_RateLimit(t *testing.T) {
+	h := startConnector(t, connector.Config{Trigger: "!", RateLimit: connector.RateLimitConfig{Global: connector.RateConfig{Rate: 20}}})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		h.say(t, "!help nope")
+	}
+	for i := 0; i < 3; i++ {
+		h.expectReply(t, "Unknown command !nope")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatal("expected replies to be throttled, took", elapsed)
+	}
+	if stats := h.connector.RateLimitStats(); stats.Throttled != 2 {
+		t.Fatalf("expected 2 throttled messages, got %+v", stats)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		max  int
+		unit connector.LengthUnit
+		want []string
+	}{
+		{name: "short", text: "hello world", max: 20, want: []string{"hello world"}},
+		{name: "words", text: "hello big world", max: 10, want: []string{"hello big", "world"}},
+		{name: "lines", text: "a b\nc d\ne f", max: 7, want: []string{"a b\nc d", "e f"}},
+		{name: "long word", text: "abcdefghij", max: 4, want: []string{"abcd", "efgh", "ij"}},
+		{name: "bytes keep runes whole", text: "ééé", max: 3, unit: connector.Bytes, want: []string{"é", "é", "é"}},
+		{name: "runes", text: "ééé ééé", max: 3, unit: connector.Runes, want: []string{"ééé", "ééé"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.max, tt.unit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("splitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnector_More(t *testing.T) {
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("remind", nil, command.FormatUsage("remind <what> <when>", "Reminds you of something at the given time")))
+	h := startConnector(t, connector.Config{Trigger: "!", Messages: connector.MessageConfig{MaxLength: 24, MaxParts: 2}}, dispatcher)
+	h.say(t, "!help remind")
+	h.expectReply(t, "Usage: !remind <what>")
+	h.expectReply(t, "<when>")
+	h.expectReply(t, "2 more, use !more")
+	h.say(t, "!more")
+	h.expectReply(t, "Reminds you of something")
+	h.expectReply(t, "at the given time")
+	h.say(t, "!more")
+	h.expectReply(t, "Nothing more to show")
+}
+
+func TestConnector_Reconnect(t *testing.T) {
+	expectEvent := func(t *testing.T, dispatcher *dummyDispatcher, eventType domain.UserEventType) {
+		for {
+			message := expectDispatched(t, dispatcher)
+			if event, ok := message.(*domain.UserEvent); ok && event.EventType() == eventType {
+				return
+			}
+		}
+	}
+	t.Run("restores the connection", func(t *testing.T) {
+		dispatcher := newDummyDispatcher(context.Background())
+		h := startConnector(t, connector.Config{Reconnect: connector.ReconnectConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}}, dispatcher)
+		h.connection.connectErrors <- fmt.Errorf("still down")
+		h.connection.recvErrors <- fmt.Errorf("connection reset")
+		h.say(t, "hello")
+		expectEvent(t, dispatcher, connection.ConnectionLost)
+		expectEvent(t, dispatcher, connection.ConnectionRestored)
+		if connects := atomic.LoadInt64(&h.connection.connects); connects != 3 {
+			t.Fatalf("expected 3 connections, got %d", connects)
+		}
+		if h.connector.Err() != nil {
+			t.Fatal("expected the connector to keep running, got", h.connector.Err())
+		}
+	})
+	t.Run("refreshes the roster", func(t *testing.T) {
+		dispatcher := newDummyDispatcher(context.Background())
+		h := startConnector(t, connector.Config{Reconnect: connector.ReconnectConfig{MaxAttempts: 3, InitialDelay: time.Millisecond}}, dispatcher)
+		h.connection.users = domain.NewUserList(h.user, domain.NewOnlineUser("other", "otherId", domain.RegularUser, time.Now()))
+		h.connection.recvErrors <- fmt.Errorf("connection reset")
+		h.say(t, "hello")
+		expectEvent(t, dispatcher, connection.ConnectionLost)
+		roster, ok := (<-dispatcher.messages).(*connection.Roster)
+		if !ok {
+			t.Fatal("expected a snapshot of the online users")
+		}
+		var users []string
+		for _, user := range roster.Users() {
+			users = append(users, user.Nick())
+		}
+		if strings.Join(users, ",") != "user,other" {
+			t.Fatalf("expected the refreshed users, got %v", users)
+		}
+	})
+	t.Run("doesn't block sends", func(t *testing.T) {
+		dispatcher := newDummyDispatcher(context.Background())
+		h := startConnector(t, connector.Config{Reconnect: connector.ReconnectConfig{MaxAttempts: 3, InitialDelay: 100 * time.Millisecond}}, dispatcher)
+		h.connection.connectErrors <- fmt.Errorf("still down")
+		h.connection.recvErrors <- fmt.Errorf("connection reset")
+		h.say(t, "hello")
+		expectEvent(t, dispatcher, connection.ConnectionLost)
+		cc := h.connector.connections[0]
+		cc.reconnectM.Lock()
+		done := cc.reconnecting
+		cc.reconnectM.Unlock()
+		if err := h.connector.send(cc, domain.NewClientMessage("hello", nil, false)); err != nil {
+			t.Fatalf("unexpected error = %v", err)
+		}
+		select {
+		case <-done:
+			t.Fatal("expected the send to return during the reconnection")
+		default:
+		}
+		expectEvent(t, dispatcher, connection.ConnectionRestored)
+	})
+	t.Run("gives up", func(t *testing.T) {
+		dispatcher := newDummyDispatcher(context.Background())
+		h := startConnector(t, connector.Config{Reconnect: connector.ReconnectConfig{MaxAttempts: 2, InitialDelay: time.Millisecond}}, dispatcher)
+		h.connection.connectErrors <- fmt.Errorf("still down")
+		h.connection.connectErrors <- fmt.Errorf("still down")
+		h.connection.recvErrors <- fmt.Errorf("connection reset")
+		h.say(t, "hello")
+		select {
+		case <-h.connector.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected the connector to give up")
+		}
+	})
+}
+
+func TestConnector_Stop(t *testing.T) {
+	h := startConnector(t, connector.Config{Trigger: "!", RateLimit: connector.RateLimitConfig{Global: connector.RateConfig{Rate: 20}}})
+	for i := 0; i < 3; i++ {
+		h.say(t, "!help nope")
+	}
+	h.expectReply(t, "Unknown command !nope")
+	for h.connector.connections[0].rateLimiter.pending() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.connector.Stop(ctx); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	if !errors.Is(h.connector.Err(), pkg.ErrStopped) {
+		t.Fatalf("expected the connector to be stopped, got %v", h.connector.Err())
+	}
+	h.expectReply(t, "Unknown command !nope")
+	h.expectReply(t, "Unknown command !nope")
+}
+
+// replyingBot answers every message it receives after a while and waits for its replies to be sent when it stops
+type replyingBot struct {
+	dummyRunnable
+	relay    rpc.DispatcherRelay
+	pending  sync.WaitGroup
+	received chan struct{}
+}
+
+func (b *replyingBot) Start(ctx context.Context) error {
+	b.ctx = ctx
+	go func() {
+		for {
+			m, err := b.relay.Recv()
+			if err != nil {
+				return
+			}
+			if _, ok := m.(*domain.ChatMessage); !ok {
+				continue
+			}
+			b.pending.Add(1)
+			b.received <- struct{}{}
+			go func() {
+				defer b.pending.Done()
+				time.Sleep(50 * time.Millisecond)
+				_ = b.relay.Send(domain.NewClientMessage("hi", nil, false))
+			}()
+		}
+	}()
+	return nil
+}
+
+func (b *replyingBot) Stop(context.Context) error {
+	b.pending.Wait()
+	return nil
+}
+
+func TestConnector_StopsTheBotOnceItHandledItsMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	registration := internalRpc.NewRegistration()
+	clientMessageQueue := queue.NewQueue[*domain.ClientMessage]()
+	serverMessageQueue := queue.NewQueue[domain.ServerMessage]()
+	clientMessageConsumer, err := clientMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverMessageConsumer, err := serverMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := &replyingBot{received: make(chan struct{}, 1)}
+	bot.relay = internalRpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(), "", nil, registration, clientMessageQueue, serverMessageConsumer)
+	h := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	h.connector = NewConnector(connector.Config{}, h.connection, internalRpc.NewDefaultConnectorRelay(bot, registration, clientMessageConsumer, serverMessageQueue), nil)
+	if err := h.connector.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h.waitForDispatchers(t, 1)
+	h.say(t, "hello")
+	<-bot.received
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), time.Second)
+	defer stopCancel()
+	if err := h.connector.Stop(stopCtx); err != nil {
+		t.Fatalf("unexpected error = %v", err)
+	}
+	h.expectReply(t, "hi")
+}
+
+func TestConnector_ClosesDispatchersAcceptedWhileStopping(t *testing.T) {
+	h := startConnector(t, connector.Config{})
+	atomic.StoreInt32(&h.connector.stopping, 1)
+	late := newDummyDispatcher(context.Background())
+	h.relay.dispatchers <- late
+	if reason := expectClosed(t, late); !errors.Is(reason, errStopping) {
+		t.Fatal("expected the dispatcher to be told the connector is stopping, got", reason)
+	}
+	if h.connector.dispatchers.len() != 0 {
+		t.Fatal("expected the dispatcher not to be registered")
+	}
+}
+
+type countingAuthenticator struct {
+	dispatch.Authenticator
+	calls int64
+}
+
+func (a *countingAuthenticator) Authenticate(handshake dispatch.Handshake, commands domain.CommandList) error {
+	atomic.AddInt64(&a.calls, 1)
+	return a.Authenticator.Authenticate(handshake, commands)
+}
+
+// startInProcess starts a connector requiring the shared token, with a bot in the same process presenting handshake
+func startInProcess(t *testing.T, handshake dispatch.Handshake) (*connectorHarness, rpc.DispatcherRelay, *countingAuthenticator) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	registration := internalRpc.NewRegistration()
+	clientMessageQueue := queue.NewQueue[*domain.ClientMessage]()
+	serverMessageQueue := queue.NewQueue[domain.ServerMessage]()
+	clientMessageConsumer, err := clientMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverMessageConsumer, err := serverMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	botRelay := internalRpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(), "", nil, registration, clientMessageQueue, serverMessageConsumer)
+	message, err := handshake.Registration([]*domain.Command{domain.NewCommand("ping", nil, "ping")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := botRelay.Connect(message); err != nil {
+		t.Fatal(err)
+	}
+	h := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	config := connector.Config{Auth: connector.AuthConfig{Tokens: []string{"shared"}}}
+	h.connector = NewConnector(config, h.connection, internalRpc.NewDefaultConnectorRelay(&dummyRunnable{ctx: ctx}, registration, clientMessageConsumer, serverMessageQueue), nil)
+	authenticator := &countingAuthenticator{Authenticator: newTokenAuthenticator(config.Auth)}
+	h.connector.SetAuthenticator(authenticator)
+	if err := h.connector.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return h, botRelay, authenticator
+}
+
+func TestConnector_RejectsBeforeAccepting(t *testing.T) {
+	h, botRelay, _ := startInProcess(t, dispatch.Handshake{Token: "wrong"})
+	select {
+	case <-botRelay.Done():
+		if !errors.Is(botRelay.Err(), errInvalidToken) {
+			t.Fatal("expected the bot to be told its token is invalid, got", botRelay.Err())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the bot's session to end")
+	}
+	if h.connector.dispatchers.len() != 0 {
+		t.Fatal("expected the bot not to be accepted")
+	}
+}
+
+func TestConnector_AdmitsOnce(t *testing.T) {
+	h, _, authenticator := startInProcess(t, dispatch.Handshake{Token: "shared"})
+	h.waitForDispatchers(t, 1)
+	if calls := atomic.LoadInt64(&authenticator.calls); calls != 1 {
+		t.Fatalf("expected the bot to be authenticated once, it was %d times", calls)
+	}
+}
+
+func TestConnector_Status(t *testing.T) {
+	h := startConnector(t, connector.Config{Name: "bot", Trigger: "!"})
+	server := httptest.NewServer(h.connector.Handler())
+	t.Cleanup(server.Close)
+	expectStatusCode := func(path string, expected int) {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if response.StatusCode != expected {
+			t.Fatalf("%s: expected %d got %d", path, expected, response.StatusCode)
+		}
+	}
+	expectStatusCode("/healthz", http.StatusOK)
+	expectStatusCode("/readyz", http.StatusServiceUnavailable)
+	h.relay.dispatchers <- newDummyDispatcher(context.Background(), domain.NewCommand("remind", nil, "remind"))
+	h.waitForDispatchers(t, 1)
+	expectStatusCode("/readyz", http.StatusOK)
+	response, err := http.Get(server.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var s status
+	if err := json.NewDecoder(response.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.BotUser != "bot" || s.OnlineUsers != 1 || len(s.Dispatchers) != 1 || s.Dispatchers[0].Commands[0] != "remind" {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	h.say(t, "!remind me")
+	h.waitForMetric(t, server.URL, `connector_commands_parsed_total{command="remind"}`)
+}
+
+func (h *connectorHarness) waitForMetric(t *testing.T, url string, metric string) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		response, err := http.Get(url + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(body), metric) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected metrics to contain", metric)
+}
+
+func TestConnector_RedactsLoggedMessages(t *testing.T) {
+	var logs strings.Builder
+	logger := logging.New(logging.Config{Level: "debug"}, &logs)
+	ctr := NewConnector(connector.Config{Log: logging.Config{Redact: logging.Hash, Secret: "key"}}, nil, nil, logger)
+	sender := domain.NewUser("user", "userId", domain.RegularUser)
+	ctr.getCommandOr(ctr.connections[0], domain.NewChatMessage("my secret", sender, nil, false, false, time.Now(), true))
+	if strings.Contains(logs.String(), "secret") {
+		t.Fatal("expected the message to be redacted, got", logs.String())
+	}
+	if !strings.Contains(logs.String(), "user_id=userId") {
+		t.Fatal("expected the sender to be logged, got", logs.String())
+	}
+}
+
+func TestConnector_MultipleConnections(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("remind", nil, "remind"))
+	irc := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	discord := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	ctr := NewMultiConnector(connector.Config{Name: "bot", Trigger: "!"}, []Connection{
+		{Name: "irc", Relay: irc.connection},
+		{Name: "discord", Trigger: "?", Relay: discord.connection},
+	}, newDummyConnectorRelay(dispatcher), nil)
+	if err := ctr.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	irc.connector, discord.connector = ctr, ctr
+	irc.waitForDispatchers(t, 1)
+	if users := ctr.onlineUsers(); users.Find("irc/user") == nil || users.Find("discord/user") == nil {
+		t.Fatalf("expected the users of both connections, got %v", users.All())
+	}
+	discord.say(t, "?remind me")
+	message, ok := expectDispatched(t, dispatcher).(*domain.CommandMessage)
+	if !ok {
+		t.Fatal("expected a command message")
+	}
+	if connection.Of(message.Sender()) != "discord" {
+		t.Fatal("expected the command to come from discord, got", message.Sender().Id())
+	}
+	if err := ctr.sendToConnection(domain.NewClientMessage("done", message.Sender(), false)); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := discord.clientMessages.Consume(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Recipient().Id() != "userId" || reply.Recipient().Nick() != "user" {
+		t.Fatalf("expected the recipient to be unqualified, got %s (%s)", reply.Recipient().Nick(), reply.Recipient().Id())
+	}
+	irc.say(t, "?remind me")
+	if message := expectDispatched(t, dispatcher).(*domain.ChatMessage); message.Sender().Id() != "irc/userId" {
+		t.Fatal("expected a chat message from irc, got", message.Sender().Id())
+	}
+	source := connection.Of(message.Sender())
+	for _, m := range []*domain.ClientMessage{domain.NewClientMessage("public", nil, false), domain.NewEmote("waves")} {
+		if err := ctr.sendToConnection(connection.ReplyOn(source, m)); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := discord.clientMessages.Consume(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Message() != m.Message() || reply.Emote() != m.Emote() || reply.Recipient() != nil {
+			t.Fatalf("expected %q to be sent back on discord as it was, got %q", m.Message(), reply.Message())
+		}
+	}
+	if err := ctr.sendToConnection(domain.NewClientMessage("hello", nil, false)); err != nil {
+		t.Fatal(err)
+	}
+	irc.expectReply(t, "hello")
+}
+
+func TestConnector_Bridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	irc := newConnectionHarness(t, domain.NewOnlineUser("alice", "aliceId", domain.RegularUser, time.Now()))
+	discord := newConnectionHarness(t, domain.NewOnlineUser("bob", "bobId", domain.RegularUser, time.Now()))
+	ctr := NewMultiConnector(connector.Config{Name: "bot", Trigger: "!", Bridge: connector.BridgeConfig{
+		Enabled:  true,
+		Announce: true,
+		Routes: []connector.BridgeRoute{
+			{From: "irc", To: "discord", Exclude: "^!"},
+			{From: "discord", To: "irc"},
+		},
+	}}, []Connection{
+		{Name: "irc", Relay: irc.connection},
+		{Name: "discord", Relay: discord.connection},
+	}, newDummyConnectorRelay(), nil)
+	if err := ctr.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	irc.say(t, "!help nope")
+	irc.expectReply(t, "Unknown command !nope")
+	irc.say(t, "hello")
+	discord.expectReply(t, "[irc] <alice> hello")
+	discord.say(t, "hi")
+	irc.expectReply(t, "[discord] <bob> hi")
+	err := discord.chatMessages.Produce(domain.NewChatMessage("[irc] <alice> hello", domain.NewUser("bot", "", domain.RegularUser), nil, false, false, time.Now(), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	discord.say(t, "ping")
+	irc.expectReply(t, "[discord] <bob> ping")
+	discord.connection.onUserJoin(domain.NewUser("carol", "carolId", domain.RegularUser), time.Now())
+	irc.expectReply(t, "carol joined discord")
+	err = discord.chatMessages.Produce(domain.NewChatMessage("not the bot", domain.NewUser("bot", "otherId", domain.RegularUser), nil, false, false, time.Now(), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	irc.expectReply(t, "[discord] <bot> not the bot")
+	irc.connection.sends = make(chan struct{})
+	discord.say(t, "while irc is stuck")
+	discord.say(t, "!help nope")
+	discord.expectReply(t, "Unknown command !nope")
+	close(irc.connection.sends)
+	irc.expectReply(t, "[discord] <bob> while irc is stuck")
+}
+
+func TestConnector_Roster(t *testing.T) {
+	first := newDummyDispatcher(context.Background())
+	h := startConnector(t, connector.Config{}, first)
+	carol := domain.NewUser("carol", "carolId", domain.RegularUser)
+	h.connection.onUserJoin(carol, time.Now())
+	h.connection.onUserJoin(carol, time.Now())
+	if users := h.connector.onlineUsers().All(); len(users) != 2 {
+		t.Fatalf("expected user and carol to be online, got %d users", len(users))
+	}
+	late := newDummyDispatcher(context.Background())
+	h.relay.dispatchers <- late
+	h.waitForDispatchers(t, 2)
+	h.connection.onUserJoin(domain.NewUser("dave", "daveId", domain.RegularUser), time.Now())
+	select {
+	case message := <-late.messages:
+		roster, ok := message.(*connection.Roster)
+		if !ok {
+			t.Fatalf("expected a snapshot of the online users, got %v", message)
+		}
+		var nicks []string
+		for _, user := range roster.Users() {
+			nicks = append(nicks, user.Nick())
+		}
+		if strings.Join(nicks, ",") != "user,carol" {
+			t.Fatalf("expected user and carol in the snapshot, got %v", nicks)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a snapshot of the online users")
+	}
+	if event, ok := expectDispatched(t, late).(*domain.UserEvent); !ok || event.EventType() != domain.UserJoined || event.User().Nick() != "dave" {
+		t.Fatal("expected dave to join")
+	}
+	sdk := newSdkDispatcher(context.Background())
+	h.relay.dispatchers <- sdk
+	for _, nick := range []string{"user", "carol", "dave"} {
+		if event, ok := expectDispatched(t, sdk).(*domain.UserEvent); !ok || event.EventType() != domain.UserJoined || event.User().Nick() != nick {
+			t.Fatalf("expected %s to join, got %v", nick, event)
+		}
+	}
+}
+
+// presenting returns a dispatcher registering commands along with handshake, understanding the connector's own messages
+func presenting(t *testing.T, handshake dispatch.Handshake, commands ...*domain.Command) *dummyDispatcher {
+	t.Helper()
+	handshake.ConnectorMessages = true
+	registration, err := handshake.Registration(commands)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newSdkDispatcher(context.Background(), registration.Commands()...)
+}
+
+func TestConnector_Subscriptions(t *testing.T) {
+	subscriber := presenting(t, dispatch.Handshake{Subscription: &dispatch.Subscription{Chat: []string{"^https?://"}}}, domain.NewCommand("remind", nil, "remind"))
+	invalid := presenting(t, dispatch.Handshake{Subscription: &dispatch.Subscription{Chat: []string{"("}}})
+	h := startConnector(t, connector.Config{Trigger: "!"}, subscriber)
+	h.relay.dispatchers <- invalid
+	time.Sleep(10 * time.Millisecond)
+	h.waitForDispatchers(t, 1)
+	h.connection.onUserJoin(domain.NewUser("carol", "carolId", domain.RegularUser), time.Now())
+	h.say(t, "hello")
+	h.say(t, "https://example.com")
+	h.say(t, "!remind me")
+	if message, ok := expectDispatched(t, subscriber).(*domain.ChatMessage); !ok || message.Message() != "https://example.com" {
+		t.Fatal("expected only the matching chat message, got", message)
+	}
+	if _, ok := expectDispatched(t, subscriber).(*domain.CommandMessage); !ok {
+		t.Fatal("expected the command")
+	}
+}
+
+func TestConnector_Authentication(t *testing.T) {
+	withToken := func(token string, commands ...*domain.Command) *dummyDispatcher {
+		return presenting(t, dispatch.Handshake{Token: token}, commands...)
+	}
+	claiming := func(token string, name string, commands ...*domain.Command) *dummyDispatcher {
+		return presenting(t, dispatch.Handshake{Token: token, Identity: dispatch.Identity{Name: name}}, commands...)
+	}
+	config := connector.Config{Trigger: "!", Auth: connector.AuthConfig{
+		Tokens: []string{"shared"},
+		Bots:   []connector.BotAuthConfig{{Name: "reminder", Token: "reminderToken", Commands: []string{"remind", "r"}}},
+	}}
+	h := startConnector(t, config,
+		withToken("shared", domain.NewCommand("ping", nil, "ping")),
+		claiming("reminderToken", "reminder", domain.NewCommand("remind", []string{"r"}, "remind")),
+	)
+	for _, rejected := range []*dummyDispatcher{
+		newDummyDispatcher(context.Background(), domain.NewCommand("missing", nil, "missing")),
+		withToken("wrong", domain.NewCommand("invalid", nil, "invalid")),
+		withToken("reminderToken", domain.NewCommand("ban", nil, "ban")),
+		claiming("shared", "reminder", domain.NewCommand("remind", nil, "remind")),
+		claiming("reminderToken", "other", domain.NewCommand("remind", nil, "remind")),
+	} {
+		h.relay.dispatchers <- rejected
+		if reason := expectClosed(t, rejected); reason == nil {
+			t.Fatal("expected the dispatcher to be told why it was rejected")
+		}
+	}
+	h.waitForDispatchers(t, 2)
+}
+
+func TestConnector_NamedDispatchers(t *testing.T) {
+	named := func(name, version string, commands ...*domain.Command) *dummyDispatcher {
+		return presenting(t, dispatch.Handshake{Identity: dispatch.Identity{Name: name, Version: version}}, commands...)
+	}
+	old := named("reminder", "1.0", domain.NewCommand("remind", nil, "remind"))
+	h := startConnector(t, connector.Config{Trigger: "!", Collisions: connector.RejectNewcomer}, old)
+	h.relay.dispatchers <- named("bad name", "", domain.NewCommand("other", nil, "other"))
+	replacement := named("reminder", "1.1", domain.NewCommand("remind", nil, "remind"))
+	h.relay.dispatchers <- replacement
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if entry := h.connector.dispatchers.get("reminder"); entry != nil && entry.dispatcher == rpc.Dispatcher(replacement) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	h.waitForDispatchers(t, 1)
+	if reason := expectClosed(t, old); !errors.Is(reason, errReplaced) {
+		t.Fatal("expected the old version to be closed, got", reason)
+	}
+	if dispatcher := h.connector.status().Dispatchers[0]; dispatcher.Id != "reminder" || dispatcher.Version != "1.1" {
+		t.Fatal("expected the new version to replace the old one, got", dispatcher)
+	}
+	if help := h.connector.help("!", nil); !strings.Contains(help, "reminder: !remind") || strings.Contains(help, dispatch.HandshakeCommand) {
+		t.Fatal("expected help to group commands by name, got", help)
+	}
+	h.say(t, "!remind me")
+	if _, ok := expectDispatched(t, replacement).(*domain.CommandMessage); !ok {
+		t.Fatal("expected the replacement to receive the command")
+	}
+}
+
+func TestConnector_Suggestions(t *testing.T) {
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("remind", []string{"r"}, "remind"), domain.NewCommand("roll", nil, "roll"))
+	h := startConnector(t, connector.Config{Trigger: "!"}, dispatcher)
+	h.say(t, "!remnd me")
+	h.expectReply(t, "Unknown command !remnd, did you mean !remind?")
+	if message, ok := expectDispatched(t, dispatcher).(*domain.ChatMessage); !ok || message.Message() != "!remnd me" {
+		t.Fatal("expected the unknown command to be passed on as chat, got", message)
+	}
+	h.say(t, "!hlp")
+	h.expectReply(t, "Unknown command !hlp, did you mean !help?")
+	h.say(t, "!weather")
+	h.say(t, "!help nope")
+	h.expectReply(t, "Unknown command !nope")
+
+	h = startConnector(t, connector.Config{Trigger: "!", Suggestions: connector.SuggestionConfig{Disabled: true}}, dispatcher)
+	h.say(t, "!remnd me")
+	h.say(t, "!help nope")
+	h.expectReply(t, "Unknown command !nope")
+}
+
+func TestConnector_MessageLengthPerConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	irc := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	discord := newConnectionHarness(t, domain.NewOnlineUser("user", "userId", domain.RegularUser, time.Now()))
+	ctr := NewMultiConnector(connector.Config{Name: "bot", Trigger: "!", Messages: connector.MessageConfig{MaxLength: 100}}, []Connection{
+		{Name: "irc", Relay: irc.connection, MaxLength: 10},
+		{Name: "discord", Relay: discord.connection},
+	}, newDummyConnectorRelay(), nil)
+	if err := ctr.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"irc", "discord"} {
+		recipient := connection.Qualify(name, domain.NewUser("user", "userId", domain.RegularUser))
+		if err := ctr.sendToConnection(domain.NewClientMessage("hello big world", recipient, true)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	irc.expectReply(t, "hello big")
+	irc.expectReply(t, "world")
+	discord.expectReply(t, "hello big world")
+}
+
+func TestConnector_KeepsIdsOfUnnamedConnection(t *testing.T) {
+	h := startConnector(t, connector.Config{Trigger: "!"})
+	alice := domain.NewUser("alice", "unaffiliated/alice", domain.RegularUser)
+	for _, m := range []*domain.ClientMessage{domain.NewClientMessage("hi", alice, true), domain.NewEmote("waves")} {
+		if err := h.connector.sendToConnection(m); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		reply, err := h.clientMessages.Consume(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reply.Emote() != m.Emote() || (m.Recipient() != nil && reply.Recipient().Id() != "unaffiliated/alice") {
+			t.Fatalf("expected %v to be sent as it is, got %v", m, reply)
+		}
+	}
+}
+
+func TestConnector_MoreOnlyWhenPaging(t *testing.T) {
+	dispatcher := newDummyDispatcher(context.Background(), domain.NewCommand("more", nil, "more"))
+	h := startConnector(t, connector.Config{Trigger: "!"}, dispatcher)
+	h.say(t, "!more")
+	if message, ok := expectDispatched(t, dispatcher).(*domain.CommandMessage); !ok || message.Command() != "more" {
+		t.Fatal("expected the dispatcher's more command, got", message)
+	}
+}
@@ -0,0 +1,283 @@
+package connector
+
+import (
+	"context"
+	"github.com/raf924/bot/v2/pkg"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultQueueSize = 256
+
+type dispatcherEntry struct {
+	// id is the name of the dispatcher, or a random key if it didn't name itself
+	id         string
+	version    string
+	dispatcher rpc.Dispatcher
+	// commands are those the dispatcher registered, without its handshake
+	commands  domain.CommandList
+	handshake dispatch.Handshake
+	outbox    chan domain.ServerMessage
+	dropped   int64
+	busy      int32
+	// ctx is cancelled with the reason the entry is disconnected
+	ctx        context.Context
+	disconnect context.CancelCauseFunc
+	// filter is nil when the dispatcher receives everything
+	filter *dispatch.Filter
+	// vetted is set once the handshake was read and checked
+	vetted bool
+}
+
+// registeredDispatcher is a dispatcher as the connector's callbacks see it, without its handshake
+type registeredDispatcher struct {
+	rpc.Dispatcher
+	commands domain.CommandList
+}
+
+func (d *registeredDispatcher) Commands() domain.CommandList {
+	return d.commands
+}
+
+func newDispatcherEntry(ctx context.Context, id string, dispatcher rpc.Dispatcher, queueSize int) *dispatcherEntry {
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &dispatcherEntry{
+		id:         id,
+		dispatcher: dispatcher,
+		commands:   dispatcher.Commands(),
+		outbox:     make(chan domain.ServerMessage, queueSize),
+		ctx:        ctx,
+		disconnect: cancel,
+	}
+}
+
+// readHandshake splits the handshake the dispatcher presented off its commands
+func (e *dispatcherEntry) readHandshake() error {
+	handshake, commands, err := dispatch.ReadHandshake(e.commands)
+	if err != nil {
+		return err
+	}
+	e.handshake = handshake
+	e.commands = commands
+	return nil
+}
+
+// registered returns the dispatcher of the entry without its handshake
+func (e *dispatcherEntry) registered() rpc.Dispatcher {
+	return &registeredDispatcher{Dispatcher: e.dispatcher, commands: e.commands}
+}
+
+// identify names the entry after its dispatcher, if it named itself
+func (e *dispatcherEntry) identify() error {
+	identity := e.handshake.Identity
+	if len(identity.Name) == 0 {
+		return nil
+	}
+	if err := identity.Validate(); err != nil {
+		return err
+	}
+	e.id = identity.Name
+	e.version = identity.Version
+	return nil
+}
+
+// subscribe applies the subscription declared by the dispatcher, if any
+func (e *dispatcherEntry) subscribe() error {
+	subscription := e.handshake.Subscription
+	if subscription == nil {
+		return nil
+	}
+	filter, err := subscription.Compile()
+	if err != nil {
+		return err
+	}
+	e.filter = filter
+	return nil
+}
+
+func (e *dispatcherEntry) accepts(m domain.ServerMessage) bool {
+	return e.filter == nil || e.filter.Accepts(m)
+}
+
+// run dispatches the queued messages in order until the entry is disconnected
+func (e *dispatcherEntry) run(logger *slog.Logger) {
+	for {
+		select {
+		case m := <-e.outbox:
+			atomic.StoreInt32(&e.busy, 1)
+			err := e.dispatcher.Dispatch(m)
+			atomic.StoreInt32(&e.busy, 0)
+			if err != nil {
+				logger.Warn("couldn't dispatch message", logging.DispatcherKey, e.id, "error", err)
+			}
+		case <-e.ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue queues m according to policy. It returns false if the entry must be disconnected
+func (e *dispatcherEntry) enqueue(m domain.ServerMessage, policy connector.OverflowPolicy) bool {
+	switch policy {
+	case connector.DropOldest:
+		for {
+			select {
+			case e.outbox <- m:
+				return true
+			default:
+			}
+			select {
+			case <-e.outbox:
+				atomic.AddInt64(&e.dropped, 1)
+			default:
+			}
+		}
+	case connector.Disconnect:
+		select {
+		case e.outbox <- m:
+			return true
+		default:
+			return false
+		}
+	default:
+		select {
+		case e.outbox <- m:
+		case <-e.ctx.Done():
+		}
+		return true
+	}
+}
+
+func (e *dispatcherEntry) depth() int {
+	return len(e.outbox)
+}
+
+// flushed tells whether every queued message was dispatched and, if its relay tells, handled by the dispatcher
+func (e *dispatcherEntry) flushed() bool {
+	if e.depth() > 0 || atomic.LoadInt32(&e.busy) == 1 {
+		return false
+	}
+	drainer, ok := e.dispatcher.(pkg.Drainer)
+	return !ok || drainer.Pending() == 0
+}
+
+// names returns every name and alias registered by the dispatcher
+func (e *dispatcherEntry) names() []string {
+	var names []string
+	for _, cmd := range e.commands.All() {
+		names = append(names, cmd.Name())
+		names = append(names, cmd.Aliases()...)
+	}
+	return names
+}
+
+func (e *dispatcherEntry) find(name string) *domain.Command {
+	return e.commands.Find(name)
+}
+
+// dispatcherRegistry keeps the accepted dispatchers in registration order
+type dispatcherRegistry struct {
+	m       sync.RWMutex
+	entries []*dispatcherEntry
+}
+
+func (r *dispatcherRegistry) add(entry *dispatcherEntry) {
+	r.m.Lock()
+	r.entries = append(r.entries, entry)
+	r.m.Unlock()
+}
+
+// remove tells whether entry was registered
+func (r *dispatcherRegistry) remove(entry *dispatcherEntry) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for i, e := range r.entries {
+		if e == entry {
+			r.entries = append(r.entries[:i:i], r.entries[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *dispatcherRegistry) get(id string) *dispatcherEntry {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	for _, entry := range r.entries {
+		if entry.id == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+// all returns a snapshot of the registered dispatchers, oldest first
+func (r *dispatcherRegistry) all() []*dispatcherEntry {
+	r.m.RLock()
+	entries := make([]*dispatcherEntry, len(r.entries))
+	copy(entries, r.entries)
+	r.m.RUnlock()
+	return entries
+}
+
+func (r *dispatcherRegistry) len() int {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return len(r.entries)
+}
+
+// owners returns the dispatchers that registered name, oldest first
+func (r *dispatcherRegistry) owners(name string) []*dispatcherEntry {
+	var owners []*dispatcherEntry
+	for _, entry := range r.all() {
+		if entry.find(name) != nil {
+			owners = append(owners, entry)
+		}
+	}
+	return owners
+}
+
+// collisions maps each name or alias of entry that is already registered to its current owners,
+// ignoring the dispatcher entry replaces
+func (r *dispatcherRegistry) collisions(entry *dispatcherEntry) map[string][]*dispatcherEntry {
+	collisions := map[string][]*dispatcherEntry{}
+	for _, name := range entry.names() {
+		var owners []*dispatcherEntry
+		for _, owner := range r.owners(name) {
+			if owner.id != entry.id {
+				owners = append(owners, owner)
+			}
+		}
+		if len(owners) > 0 {
+			collisions[name] = owners
+		}
+	}
+	return collisions
+}
+
+// ambiguous maps each name registered by more than one dispatcher to its owners
+func (r *dispatcherRegistry) ambiguous() map[string][]*dispatcherEntry {
+	ambiguous := map[string][]*dispatcherEntry{}
+	seen := map[string]bool{}
+	for _, entry := range r.all() {
+		for _, name := range entry.names() {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if owners := r.owners(name); len(owners) > 1 {
+				ambiguous[name] = owners
+			}
+		}
+	}
+	return ambiguous
+}
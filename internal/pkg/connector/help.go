@@ -0,0 +1,94 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/connector-sdk/domain"
+	"sort"
+	"strings"
+)
+
+var helpCommand = domain.NewCommand("help", []string{"h"}, command.FormatUsage("help [command]", "Lists the available commands or describes one of them"))
+
+// builtins returns the commands answered by the connector itself
+func (c *Connector) builtins() []*domain.Command {
+	if c.paging() {
+		return []*domain.Command{helpCommand, moreCommand}
+	}
+	return []*domain.Command{helpCommand}
+}
+
+func (c *Connector) findBuiltin(name string) *domain.Command {
+	for _, cmd := range c.builtins() {
+		if command.Is(name, cmd) {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func (c *Connector) help(trigger string, args []string) string {
+	if len(args) > 0 {
+		return c.describeCommand(trigger, strings.TrimPrefix(args[0], trigger))
+	}
+	return c.listCommands(trigger)
+}
+
+func (c *Connector) describeCommand(trigger, name string) string {
+	cmd := c.findBuiltin(name)
+	if cmd == nil {
+		cmd, _ = c.resolve(name)
+	}
+	if cmd == nil {
+		return fmt.Sprintf("Unknown command %s%s", trigger, name)
+	}
+	usage, description := command.ParseUsage(cmd.Usage())
+	if len(usage) == 0 {
+		usage = cmd.Name()
+	}
+	lines := []string{fmt.Sprintf("Usage: %s%s", trigger, strings.TrimPrefix(usage, trigger))}
+	if len(description) > 0 {
+		lines = append(lines, description)
+	}
+	if aliases := cmd.Aliases(); len(aliases) > 0 {
+		var names []string
+		for _, alias := range aliases {
+			names = append(names, trigger+alias)
+		}
+		lines = append(lines, fmt.Sprintf("Aliases: %s", strings.Join(names, ", ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (c *Connector) listCommands(trigger string) string {
+	var groups []string
+	for _, entry := range c.dispatchers.all() {
+		var names []string
+		for _, cmd := range entry.commands.All() {
+			name := trigger + cmd.Name()
+			if len(cmd.Aliases()) > 0 {
+				name = fmt.Sprintf("%s (%s%s)", name, trigger, strings.Join(cmd.Aliases(), ", "+trigger))
+			}
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		groups = append(groups, fmt.Sprintf("%s: %s", entry.id, strings.Join(names, ", ")))
+	}
+	sort.Strings(groups)
+	var ambiguous []string
+	for name, owners := range c.dispatchers.ambiguous() {
+		var ids []string
+		for _, owner := range owners {
+			ids = append(ids, owner.id)
+		}
+		ambiguous = append(ambiguous, fmt.Sprintf("%s%s (%s)", trigger, name, strings.Join(ids, ", ")))
+	}
+	if len(ambiguous) > 0 {
+		sort.Strings(ambiguous)
+		groups = append(groups, fmt.Sprintf("Ambiguous: %s", strings.Join(ambiguous, ", ")))
+	}
+	return strings.Join(append(groups, fmt.Sprintf("Use %s%s <command> for details", trigger, helpCommand.Name())), "\n")
+}
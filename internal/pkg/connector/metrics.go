@@ -0,0 +1,12 @@
+package connector
+
+import "github.com/raf924/bot/v2/pkg/metrics"
+
+var (
+	messagesReceived = metrics.NewCounter("connector_messages_received_total", "Chat messages received from the chat service")
+	commandsParsed   = metrics.NewCounter("connector_commands_parsed_total", "Commands parsed from chat messages", "command")
+	sendErrors       = metrics.NewCounter("connector_send_errors_total", "Messages that couldn't be sent to the chat service")
+	dispatcherCount  = metrics.NewGauge("connector_dispatchers", "Dispatchers attached to the connector")
+	rejections       = metrics.NewCounter("connector_dispatcher_rejections_total", "Dispatchers the connector refused", "reason")
+	bridgeDrops      = metrics.NewCounter("connector_bridge_drops_total", "Bridged messages dropped because the connection they were relayed to was too slow", "connection")
+)
@@ -0,0 +1,190 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var moreCommand = domain.NewCommand("more", nil, command.FormatUsage("more", "Shows the next part of a long reply"))
+
+func length(s string, unit connector.LengthUnit) int {
+	if unit == connector.Runes {
+		return utf8.RuneCountInString(s)
+	}
+	return len(s)
+}
+
+// cut returns the longest prefix of s that fits in max, never splitting a rune
+func cut(s string, max int, unit connector.LengthUnit) (string, string) {
+	n := 0
+	for i, r := range s {
+		size := 1
+		if unit != connector.Runes {
+			size = utf8.RuneLen(r)
+		}
+		if n+size > max {
+			if i == 0 {
+				_, width := utf8.DecodeRuneInString(s)
+				return s[:width], s[width:]
+			}
+			return s[:i], s[i:]
+		}
+		n += size
+	}
+	return s, ""
+}
+
+// splitMessage splits text into parts no longer than max, preferring line and then word boundaries
+func splitMessage(text string, max int, unit connector.LengthUnit) []string {
+	if max <= 0 || length(text, unit) <= max {
+		return []string{text}
+	}
+	var parts []string
+	var current string
+	flush := func() {
+		if len(current) > 0 {
+			parts = append(parts, current)
+			current = ""
+		}
+	}
+	appendPiece := func(piece string, separator string) bool {
+		if len(current) == 0 {
+			if length(piece, unit) <= max {
+				current = piece
+				return true
+			}
+			return false
+		}
+		if length(current+separator+piece, unit) <= max {
+			current += separator + piece
+			return true
+		}
+		return false
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if appendPiece(line, "\n") {
+			continue
+		}
+		flush()
+		if appendPiece(line, "\n") {
+			continue
+		}
+		for _, word := range strings.FieldsFunc(line, unicode.IsSpace) {
+			if appendPiece(word, " ") {
+				continue
+			}
+			flush()
+			for !appendPiece(word, " ") {
+				var head string
+				head, word = cut(word, max, unit)
+				parts = append(parts, head)
+			}
+		}
+		flush()
+	}
+	flush()
+	return parts
+}
+
+// pager keeps the parts of long replies that haven't been sent yet
+type pager struct {
+	m       sync.Mutex
+	pending map[string][]*domain.ClientMessage
+}
+
+func pageKey(private bool, user *domain.User) string {
+	if !private || user == nil {
+		return ""
+	}
+	return user.Nick()
+}
+
+// page returns the messages to send now and keeps the rest for the next call to more
+func (p *pager) page(key string, messages []*domain.ClientMessage, maxParts int) []*domain.ClientMessage {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if maxParts <= 0 || len(messages) <= maxParts {
+		delete(p.pending, key)
+		return messages
+	}
+	if p.pending == nil {
+		p.pending = map[string][]*domain.ClientMessage{}
+	}
+	p.pending[key] = messages[maxParts:]
+	return messages[:maxParts:maxParts]
+}
+
+func (p *pager) more(key string, maxParts int) ([]*domain.ClientMessage, int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	pending := p.pending[key]
+	if len(pending) <= maxParts {
+		delete(p.pending, key)
+		return pending, 0
+	}
+	p.pending[key] = pending[maxParts:]
+	return pending[:maxParts:maxParts], len(pending) - maxParts
+}
+
+func (p *pager) remaining(key string) int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return len(p.pending[key])
+}
+
+// split breaks m into messages that fit cc and pages them if there are too many
+func (c *Connector) split(cc *chatConnection, m *domain.ClientMessage) []*domain.ClientMessage {
+	parts := splitMessage(m.Message(), cc.maxLength, cc.unit)
+	if len(parts) == 1 {
+		return []*domain.ClientMessage{m}
+	}
+	messages := make([]*domain.ClientMessage, len(parts))
+	for i, part := range parts {
+		if m.Emote() {
+			messages[i] = domain.NewEmote(part)
+		} else {
+			messages[i] = domain.NewClientMessage(part, m.Recipient(), m.Private())
+		}
+	}
+	key := pageKey(m.Private(), m.Recipient())
+	messages = cc.pager.page(key, messages, c.config.Messages.MaxParts)
+	if remaining := cc.pager.remaining(key); remaining > 0 {
+		messages = append(messages, moreHint(cc, m.Recipient(), m.Private(), remaining))
+	}
+	return messages
+}
+
+// paging tells whether long replies are paged on at least one connection, which makes !more available
+func (c *Connector) paging() bool {
+	if c.config.Messages.MaxParts <= 0 {
+		return false
+	}
+	for _, cc := range c.connections {
+		if cc.maxLength > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func moreHint(cc *chatConnection, recipient *domain.User, private bool, remaining int) *domain.ClientMessage {
+	return domain.NewClientMessage(fmt.Sprintf("%d more, use %s%s", remaining, cc.trigger, moreCommand.Name()), recipient, private)
+}
+
+func (c *Connector) more(cc *chatConnection, mP *domain.ChatMessage) []*domain.ClientMessage {
+	key := pageKey(mP.Private(), mP.Sender())
+	messages, remaining := cc.pager.more(key, c.config.Messages.MaxParts)
+	if len(messages) == 0 {
+		return []*domain.ClientMessage{domain.NewClientMessage("Nothing more to show", mP.Sender(), mP.Private())}
+	}
+	if remaining > 0 {
+		messages = append(messages, moreHint(cc, mP.Sender(), mP.Private(), remaining))
+	}
+	return messages
+}
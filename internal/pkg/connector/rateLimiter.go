@@ -0,0 +1,255 @@
+package connector
+
+import (
+	"context"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultRateLimitQueueSize = 64
+
+const maxIdleBuckets = 256
+
+// tokenBucket hands out reservations: a message may be sent once the wait returned by reserve has elapsed
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(config connector.RateConfig, now time.Time) *tokenBucket {
+	burst := float64(config.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: config.Rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait returns how long until a token is available
+func (b *tokenBucket) wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	b.tokens--
+}
+
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+type RateLimitStats struct {
+	Throttled uint64
+	Dropped   uint64
+	Coalesced uint64
+}
+
+type queuedMessage struct {
+	*domain.ClientMessage
+	throttled bool
+}
+
+// rateLimiter queues outgoing messages and releases them according to a global and a per-recipient token bucket.
+// A message waiting for its recipient's bucket doesn't hold back the messages going to other recipients
+type rateLimiter struct {
+	config    connector.RateLimitConfig
+	m         sync.Mutex
+	queue     []*queuedMessage
+	notify    chan struct{}
+	global    *tokenBucket
+	buckets   map[string]*tokenBucket
+	inFlight  int32
+	throttled uint64
+	dropped   uint64
+	coalesced uint64
+}
+
+func newRateLimiter(config connector.RateLimitConfig) *rateLimiter {
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultRateLimitQueueSize
+	}
+	return &rateLimiter{
+		config:  config,
+		notify:  make(chan struct{}, 1),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+func (r *rateLimiter) enabled() bool {
+	return r.config.Global.Rate > 0 || r.config.PerRecipient.Rate > 0
+}
+
+func recipientKey(m *domain.ClientMessage) string {
+	if !m.Private() || m.Recipient() == nil {
+		return ""
+	}
+	return m.Recipient().Nick()
+}
+
+func (r *rateLimiter) push(m *domain.ClientMessage) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.queue) >= r.config.QueueSize {
+		if r.config.Overflow == connector.Coalesce && r.coalesce(m) {
+			atomic.AddUint64(&r.coalesced, 1)
+			return
+		}
+		atomic.AddUint64(&r.dropped, 1)
+		return
+	}
+	r.queue = append(r.queue, &queuedMessage{ClientMessage: m})
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// coalesce appends m to the last queued message going to the same place
+func (r *rateLimiter) coalesce(m *domain.ClientMessage) bool {
+	if m.Emote() {
+		return false
+	}
+	for i := len(r.queue) - 1; i >= 0; i-- {
+		queued := r.queue[i]
+		if queued.Emote() || queued.Private() != m.Private() || recipientKey(queued.ClientMessage) != recipientKey(m) {
+			continue
+		}
+		queued.ClientMessage = domain.NewClientMessage(queued.Message()+"\n"+m.Message(), queued.Recipient(), queued.Private())
+		return true
+	}
+	return false
+}
+
+func (r *rateLimiter) bucket(m *domain.ClientMessage, now time.Time) *tokenBucket {
+	key := recipientKey(m)
+	bucket, ok := r.buckets[key]
+	if !ok {
+		r.prune(now)
+		bucket = newTokenBucket(r.config.PerRecipient, now)
+		r.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// wait returns how long m must wait for the limits to let it through
+func (r *rateLimiter) wait(m *domain.ClientMessage, now time.Time) time.Duration {
+	var wait time.Duration
+	if r.config.Global.Rate > 0 {
+		if r.global == nil {
+			r.global = newTokenBucket(r.config.Global, now)
+		}
+		wait = r.global.wait(now)
+	}
+	if r.config.PerRecipient.Rate > 0 {
+		if recipientWait := r.bucket(m, now).wait(now); recipientWait > wait {
+			wait = recipientWait
+		}
+	}
+	return wait
+}
+
+// next removes the oldest queued message the limits let through and takes its tokens.
+// If there is none, it returns how long until one may be, or 0 if the queue is empty
+func (r *rateLimiter) next(now time.Time) (*domain.ClientMessage, time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	var shortest time.Duration
+	for i, queued := range r.queue {
+		wait := r.wait(queued.ClientMessage, now)
+		if wait > 0 {
+			if !queued.throttled {
+				queued.throttled = true
+				atomic.AddUint64(&r.throttled, 1)
+			}
+			if shortest == 0 || wait < shortest {
+				shortest = wait
+			}
+			continue
+		}
+		if r.global != nil {
+			r.global.take()
+		}
+		if r.config.PerRecipient.Rate > 0 {
+			r.bucket(queued.ClientMessage, now).take()
+		}
+		r.queue = append(r.queue[:i:i], r.queue[i+1:]...)
+		atomic.StoreInt32(&r.inFlight, 1)
+		return queued.ClientMessage, 0
+	}
+	return nil, shortest
+}
+
+func (r *rateLimiter) prune(now time.Time) {
+	if len(r.buckets) < maxIdleBuckets {
+		return
+	}
+	for key, bucket := range r.buckets {
+		if bucket.idle(now) {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// run sends the queued messages as fast as the limits allow until ctx is done or send fails
+func (r *rateLimiter) run(ctx context.Context, send func(m *domain.ClientMessage) error) error {
+	for {
+		m, wait := r.next(time.Now())
+		if m != nil {
+			err := send(m)
+			atomic.StoreInt32(&r.inFlight, 0)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		var ready <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			ready = timer.C
+		}
+		select {
+		case <-ready:
+		case <-r.notify:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// pending returns the number of messages that haven't been sent yet
+func (r *rateLimiter) pending() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return len(r.queue) + int(atomic.LoadInt32(&r.inFlight))
+}
+
+func (r *rateLimiter) stats() RateLimitStats {
+	return RateLimitStats{
+		Throttled: atomic.LoadUint64(&r.throttled),
+		Dropped:   atomic.LoadUint64(&r.dropped),
+		Coalesced: atomic.LoadUint64(&r.coalesced),
+	}
+}
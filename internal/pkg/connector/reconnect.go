@@ -0,0 +1,157 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/domain"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultInitialReconnectDelay = time.Second
+	defaultMaxReconnectDelay     = time.Minute
+)
+
+// backoff returns the delay before the given reconnection attempt, starting at 1, with jitter
+func (c *Connector) backoff(attempt int) time.Duration {
+	delay, maxDelay := c.config.Reconnect.InitialDelay, c.config.Reconnect.MaxDelay
+	if delay <= 0 {
+		delay = defaultInitialReconnectDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxReconnectDelay
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// errReconnecting is returned by recover when another caller is already reconnecting the connection
+var errReconnecting = errors.New("the connection is being restored")
+
+// recover reconnects cc to its chat service after cause happened on the given generation of the connection.
+// It returns nil once the connection is usable again or if another caller already restored it,
+// and errReconnecting right away if another caller is restoring it
+func (c *Connector) recover(cc *chatConnection, generation uint64, cause error) error {
+	maxAttempts := c.config.Reconnect.MaxAttempts
+	if maxAttempts == 0 || c.Err() != nil {
+		return cause
+	}
+	done, ok := cc.startReconnecting(generation)
+	if !ok {
+		if done != nil {
+			return errReconnecting
+		}
+		return nil
+	}
+	defer cc.stopReconnecting(done)
+	c.logger.Warn("connection lost", "connection", cc.name, "error", cause)
+	_ = c.sendToDispatchers(domain.NewUserEvent(cc.qualify(cc.botUser), connection.ConnectionLost, time.Now()))
+	for attempt := 1; maxAttempts < 0 || attempt <= maxAttempts; attempt++ {
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-c.Done():
+			return c.Err()
+		}
+		_, users, err := cc.relay.Connect(c.config.Name)
+		if err != nil {
+			c.logger.Warn("reconnection failed", "connection", cc.name, "attempt", attempt, "error", err)
+			continue
+		}
+		c.refreshUsers(cc, users)
+		atomic.AddUint64(&cc.generation, 1)
+		cc.setConnected(true)
+		c.logger.Info("connection restored", "connection", cc.name, "attempts", attempt)
+		return c.sendToDispatchers(domain.NewUserEvent(cc.qualify(cc.botUser), connection.ConnectionRestored, time.Now()))
+	}
+	return fmt.Errorf("couldn't reconnect after %d attempts: %w", maxAttempts, cause)
+}
+
+// startReconnecting marks cc as being reconnected unless the given generation was already replaced
+// or another caller is reconnecting it, in which case it returns the channel closed once that caller is done
+func (cc *chatConnection) startReconnecting(generation uint64) (chan struct{}, bool) {
+	cc.reconnectM.Lock()
+	defer cc.reconnectM.Unlock()
+	if cc.reconnecting != nil {
+		return cc.reconnecting, false
+	}
+	if cc.connectionGeneration() != generation {
+		return nil, false
+	}
+	cc.reconnecting = make(chan struct{})
+	cc.setConnected(false)
+	return cc.reconnecting, true
+}
+
+func (cc *chatConnection) stopReconnecting(done chan struct{}) {
+	cc.reconnectM.Lock()
+	cc.reconnecting = nil
+	cc.reconnectM.Unlock()
+	close(done)
+}
+
+// waitReconnection blocks until nobody is reconnecting cc or ctx is done
+func (cc *chatConnection) waitReconnection(ctx context.Context) {
+	cc.reconnectM.Lock()
+	done := cc.reconnecting
+	cc.reconnectM.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// refreshUsers replaces the user list of cc and sends the dispatchers the new snapshot of the online users
+func (c *Connector) refreshUsers(cc *chatConnection, users domain.UserList) {
+	c.rosterM.Lock()
+	defer c.rosterM.Unlock()
+	cc.users.reset(users.All())
+	for _, entry := range c.dispatchers.all() {
+		if err := c.sendRoster(entry); err != nil {
+			c.logger.Warn("couldn't send the online users", logging.DispatcherKey, entry.id, "error", err)
+		}
+	}
+}
+
+// send sends m to cc, reconnecting and trying again once if it fails
+// A message sent while another caller restores the connection is dropped rather than waiting for it
+func (c *Connector) send(cc *chatConnection, m *domain.ClientMessage) error {
+	generation := cc.connectionGeneration()
+	if !cc.isConnected() {
+		return c.drop(cc)
+	}
+	err := cc.relay.Send(m)
+	if err == nil {
+		return nil
+	}
+	sendErrors.Inc()
+	if err := c.recover(cc, generation, err); err != nil {
+		if errors.Is(err, errReconnecting) {
+			return c.drop(cc)
+		}
+		return err
+	}
+	err = cc.relay.Send(m)
+	if err != nil {
+		sendErrors.Inc()
+	}
+	return err
+}
+
+func (c *Connector) drop(cc *chatConnection) error {
+	sendErrors.Inc()
+	c.logger.Warn("connection is down, message dropped", "connection", cc.name)
+	return nil
+}
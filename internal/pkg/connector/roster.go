@@ -0,0 +1,101 @@
+package connector
+
+import (
+	"github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+	"time"
+)
+
+// roster is the live list of the users of a connection, a user appears once whatever the relay reports
+type roster struct {
+	m     sync.RWMutex
+	users []*domain.User
+}
+
+func (r *roster) index(nick string) int {
+	for i, user := range r.users {
+		if user.Nick() == nick {
+			return i
+		}
+	}
+	return -1
+}
+
+// join adds user or replaces the user with the same nick
+func (r *roster) join(user *domain.User) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if i := r.index(user.Nick()); i >= 0 {
+		r.users[i] = user
+		return
+	}
+	r.users = append(r.users, user)
+}
+
+func (r *roster) leave(user *domain.User) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if i := r.index(user.Nick()); i >= 0 {
+		r.users = append(r.users[:i:i], r.users[i+1:]...)
+	}
+}
+
+func (r *roster) reset(users []*domain.User) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.users = nil
+	for _, user := range users {
+		if r.index(user.Nick()) < 0 {
+			r.users = append(r.users, user)
+		}
+	}
+}
+
+func (r *roster) find(nick string) *domain.User {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if i := r.index(nick); i >= 0 {
+		return r.users[i]
+	}
+	return nil
+}
+
+func (r *roster) all() []*domain.User {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return append([]*domain.User(nil), r.users...)
+}
+
+// list returns a snapshot of the roster
+func (r *roster) list() domain.UserList {
+	return domain.ImmutableUserList(domain.NewUserList(r.all()...))
+}
+
+// userEvent updates the roster of cc and sends the event to the dispatchers, so that they receive the changes in order
+func (c *Connector) userEvent(cc *chatConnection, user *domain.User, eventType domain.UserEventType, timestamp time.Time) error {
+	c.rosterM.Lock()
+	defer c.rosterM.Unlock()
+	switch eventType {
+	case domain.UserJoined:
+		cc.users.join(user)
+	case domain.UserLeft:
+		cc.users.leave(user)
+	}
+	return c.sendToDispatchers(domain.NewUserEvent(cc.qualify(user), eventType, timestamp))
+}
+
+// sendRoster sends entry the snapshot of the online users, as a single message if it understands it
+// or else as UserJoined events. It must be called with rosterM held
+func (c *Connector) sendRoster(entry *dispatcherEntry) error {
+	users, now := c.onlineUsers().All(), time.Now()
+	if entry.handshake.ConnectorMessages {
+		return c.sendToDispatchers(connection.NewRoster(users, now), entry)
+	}
+	for _, user := range users {
+		if err := c.sendToDispatchers(domain.NewUserEvent(user, domain.UserJoined, now), entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
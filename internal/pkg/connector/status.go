@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"encoding/json"
+	"github.com/raf924/bot/v2/pkg/metrics"
+	"net"
+	"net/http"
+	"time"
+)
+
+type dispatcherStatus struct {
+	Id         string   `json:"id"`
+	Version    string   `json:"version,omitempty"`
+	Commands   []string `json:"commands"`
+	QueueDepth int      `json:"queueDepth"`
+}
+
+type connectionStatus struct {
+	Name        string `json:"name"`
+	Connected   bool   `json:"connected"`
+	OnlineUsers int    `json:"onlineUsers"`
+}
+
+type status struct {
+	BotUser     string             `json:"botUser"`
+	Connected   bool               `json:"connected"`
+	OnlineUsers int                `json:"onlineUsers"`
+	Connections []connectionStatus `json:"connections"`
+	Dispatchers []dispatcherStatus `json:"dispatchers"`
+	Uptime      string             `json:"uptime"`
+	RateLimit   RateLimitStats     `json:"rateLimit"`
+}
+
+// isConnected tells whether every connection is up
+func (c *Connector) isConnected() bool {
+	if c.Err() != nil {
+		return false
+	}
+	for _, cc := range c.connections {
+		if !cc.isConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Connector) status() status {
+	s := status{
+		Connected:   c.isConnected(),
+		OnlineUsers: len(c.onlineUsers().All()),
+		Connections: []connectionStatus{},
+		Dispatchers: []dispatcherStatus{},
+		Uptime:      time.Since(c.startedAt).Round(time.Second).String(),
+		RateLimit:   c.RateLimitStats(),
+	}
+	if botUser := c.connections[0].botUser; botUser != nil {
+		s.BotUser = botUser.Nick()
+	}
+	for _, cc := range c.connections {
+		s.Connections = append(s.Connections, connectionStatus{
+			Name:        cc.name,
+			Connected:   cc.isConnected(),
+			OnlineUsers: len(cc.onlineUsers().All()),
+		})
+	}
+	for _, entry := range c.dispatchers.all() {
+		dispatcher := dispatcherStatus{Id: entry.id, Version: entry.version, Commands: []string{}, QueueDepth: entry.depth()}
+		for _, cmd := range entry.commands.All() {
+			dispatcher.Commands = append(dispatcher.Commands, cmd.Name())
+		}
+		s.Dispatchers = append(s.Dispatchers, dispatcher)
+	}
+	return s
+}
+
+func probe(ok bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ok {
+			http.Error(w, "not ok", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}
+}
+
+// Handler serves /healthz which succeeds while the connection to the chat service is alive,
+// /readyz which succeeds once a dispatcher is attached, /status which describes the connector in JSON
+// and /metrics in the Prometheus text format
+func (c *Connector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		probe(c.isConnected())(w, r)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		probe(c.isConnected() && c.dispatchers.len() > 0)(w, r)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.status()); err != nil {
+			c.logger.Warn("couldn't write status", "error", err)
+		}
+	})
+	mux.Handle("/metrics", metrics.Default.Handler())
+	return mux
+}
+
+func (c *Connector) serveStatus() error {
+	if len(c.config.Status.Address) == 0 {
+		return nil
+	}
+	listener, err := net.Listen("tcp", c.config.Status.Address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: c.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-c.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			c.logger.Error("status server failed", "error", err)
+		}
+	}()
+	return nil
+}
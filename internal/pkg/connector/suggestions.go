@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+)
+
+const (
+	defaultMaxDistance = 2
+	maxSuggestions     = 3
+)
+
+// commandNames maps every name and alias that can be invoked, namespaced ones included, to the name of its command
+func (c *Connector) commandNames() map[string]string {
+	names := map[string]string{}
+	add := func(prefix string, cmd *domain.Command) {
+		for _, name := range append([]string{cmd.Name()}, cmd.Aliases()...) {
+			names[prefix+name] = prefix + cmd.Name()
+		}
+	}
+	for _, cmd := range c.builtins() {
+		add("", cmd)
+	}
+	for _, entry := range c.dispatchers.all() {
+		for _, cmd := range entry.commands.All() {
+			add("", cmd)
+			if c.config.Collisions == connector.Namespace {
+				add(entry.id+":", cmd)
+			}
+		}
+	}
+	return names
+}
+
+// suggest replies with the commands closest to word, if any
+func (c *Connector) suggest(cc *chatConnection, mP *domain.ChatMessage, trigger string, word string) {
+	if c.config.Suggestions.Disabled {
+		return
+	}
+	maxDistance := c.config.Suggestions.MaxDistance
+	if maxDistance <= 0 {
+		maxDistance = defaultMaxDistance
+	}
+	names := c.commandNames()
+	candidates := make([]string, 0, len(names))
+	for name := range names {
+		candidates = append(candidates, name)
+	}
+	var suggestions []string
+	seen := map[string]bool{}
+	for _, candidate := range command.Suggest(word, candidates, maxDistance) {
+		name := names[candidate]
+		if seen[name] || len(suggestions) == maxSuggestions {
+			continue
+		}
+		seen[name] = true
+		suggestions = append(suggestions, trigger+name)
+	}
+	if len(suggestions) == 0 {
+		return
+	}
+	c.reply(cc, mP, fmt.Sprintf("Unknown command %s%s, did you mean %s?", trigger, word, strings.Join(suggestions, " or ")))
+}
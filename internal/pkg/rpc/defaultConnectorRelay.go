@@ -3,15 +3,21 @@ package rpc
 import (
 	"context"
 	"github.com/raf924/bot/v2/pkg"
+	"github.com/raf924/bot/v2/pkg/dispatch"
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/connector-sdk/rpc"
 	"github.com/raf924/queue"
+	"sync/atomic"
 )
 
 type defaultConnectorRelay struct {
-	ctx                   context.Context
-	accepted              bool
+	ctx      context.Context
+	accepted bool
+	// handling is true while the connector handles the last reply it received
+	handling              bool
 	bot                   pkg.Runnable
+	registration          *Registration
+	admit                 func(dispatcher rpc.Dispatcher) error
 	clientMessageConsumer queue.Consumer[*domain.ClientMessage]
 	serverMessageProducer queue.Producer[domain.ServerMessage]
 }
@@ -25,21 +31,55 @@ func (d *defaultConnectorRelay) Start(ctx context.Context, _ *domain.User, _ dom
 	return nil
 }
 
+// Stop stops the bot gracefully so that its pending replies are sent
+func (d *defaultConnectorRelay) Stop(ctx context.Context) error {
+	return pkg.Stop(ctx, d.bot)
+}
+
 func (d *defaultConnectorRelay) Accept() (rpc.Dispatcher, error) {
 	if d.accepted {
 		<-d.ctx.Done()
 		return nil, d.ctx.Err()
 	}
 	d.accepted = true
-	return &defaultDispatcher{
-		ctx:                   d.ctx,
-		commands:              domain.NewCommandList(),
+	dispatcher := &defaultDispatcher{
+		ctx:                   d.registration.session(d.ctx),
+		registration:          d.registration,
 		serverMessageProducer: d.serverMessageProducer,
-	}, nil
+	}
+	if d.admit != nil {
+		if err := d.admit(dispatcher); err != nil {
+			d.registration.close(err)
+			<-d.ctx.Done()
+			return nil, d.ctx.Err()
+		}
+	}
+	return dispatcher, nil
+}
+
+// SetAdmission makes Accept vet the bot with admit. The bot registers as it starts, before the connector accepts it,
+// so a rejected bot has already been confirmed and its session is ended instead
+func (d *defaultConnectorRelay) SetAdmission(admit func(dispatcher rpc.Dispatcher) error) {
+	d.admit = admit
 }
 
+// Recv returns the next reply of the bot, the previous one is handled once the connector asks for the next one
 func (d *defaultConnectorRelay) Recv() (*domain.ClientMessage, error) {
-	return d.clientMessageConsumer.Consume(d.ctx)
+	if d.handling {
+		d.handling = false
+		atomic.AddInt64(&d.registration.replies, -1)
+	}
+	m, err := d.clientMessageConsumer.Consume(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.handling = true
+	return m, nil
+}
+
+// Pending returns the number of replies of the bot the connector hasn't handled yet
+func (d *defaultConnectorRelay) Pending() int {
+	return d.registration.pendingReplies()
 }
 
 func (d *defaultConnectorRelay) Done() <-chan struct{} {
@@ -51,10 +91,16 @@ func (d *defaultConnectorRelay) Err() error {
 }
 
 var _ rpc.ConnectorRelay = (*defaultConnectorRelay)(nil)
+var _ pkg.Stopper = (*defaultConnectorRelay)(nil)
+var _ pkg.Drainer = (*defaultConnectorRelay)(nil)
+var _ dispatch.Admitter = (*defaultConnectorRelay)(nil)
 
-func NewDefaultConnectorRelay(runnable pkg.Runnable, clientMessageConsumer queue.Consumer[*domain.ClientMessage], serverMessageProducer queue.Producer[domain.ServerMessage]) rpc.ConnectorRelay {
+// NewDefaultConnectorRelay returns a relay for a connector running runnable, a bot, in the same process.
+// registration must be shared with the bot's relay
+func NewDefaultConnectorRelay(runnable pkg.Runnable, registration *Registration, clientMessageConsumer queue.Consumer[*domain.ClientMessage], serverMessageProducer queue.Producer[domain.ServerMessage]) rpc.ConnectorRelay {
 	return &defaultConnectorRelay{
 		bot:                   runnable,
+		registration:          registration,
 		accepted:              false,
 		serverMessageProducer: serverMessageProducer,
 		clientMessageConsumer: clientMessageConsumer,
@@ -2,23 +2,42 @@ package rpc
 
 import (
 	"context"
+	"github.com/raf924/bot/v2/pkg"
+	"github.com/raf924/bot/v2/pkg/dispatch"
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/connector-sdk/rpc"
 	"github.com/raf924/queue"
+	"sync/atomic"
 )
 
 type defaultDispatcher struct {
 	ctx                   context.Context
-	commands              domain.CommandList
+	registration          *Registration
 	serverMessageProducer queue.Producer[domain.ServerMessage]
 }
 
 func (d *defaultDispatcher) Dispatch(message domain.ServerMessage) error {
-	return d.serverMessageProducer.Produce(message)
+	atomic.AddInt64(&d.registration.messages, 1)
+	err := d.serverMessageProducer.Produce(message)
+	if err != nil {
+		atomic.AddInt64(&d.registration.messages, -1)
+	}
+	return err
+}
+
+// Pending returns the number of dispatched messages the bot hasn't handled yet
+func (d *defaultDispatcher) Pending() int {
+	return d.registration.pendingMessages()
 }
 
 func (d *defaultDispatcher) Commands() domain.CommandList {
-	return d.commands
+	return d.registration.commands
+}
+
+// Close ends the session of the bot, its relay fails with reason
+func (d *defaultDispatcher) Close(reason error) error {
+	d.registration.close(reason)
+	return nil
 }
 
 func (d *defaultDispatcher) Done() <-chan struct{} {
@@ -26,7 +45,9 @@ func (d *defaultDispatcher) Done() <-chan struct{} {
 }
 
 func (d *defaultDispatcher) Err() error {
-	return d.ctx.Err()
+	return context.Cause(d.ctx)
 }
 
 var _ rpc.Dispatcher = (*defaultDispatcher)(nil)
+var _ dispatch.Closer = (*defaultDispatcher)(nil)
+var _ pkg.Drainer = (*defaultDispatcher)(nil)
@@ -5,27 +5,47 @@ import (
 	"github.com/raf924/connector-sdk/domain"
 	"github.com/raf924/connector-sdk/rpc"
 	"github.com/raf924/queue"
+	"sync/atomic"
 )
 
 type defaultDispatcherRelay struct {
-	ctx                   context.Context
-	onlineUsers           domain.UserList
-	trigger               string
-	currentUser           *domain.User
+	ctx          context.Context
+	onlineUsers  domain.UserList
+	trigger      string
+	currentUser  *domain.User
+	registration *Registration
+	// handling is true while the bot handles the last message it received
+	handling              bool
 	clientMessageProducer queue.Producer[*domain.ClientMessage]
 	serverMessageConsumer queue.Consumer[domain.ServerMessage]
 }
 
-func (d *defaultDispatcherRelay) Connect(*domain.RegistrationMessage) (*domain.ConfirmationMessage, error) {
+func (d *defaultDispatcherRelay) Connect(registration *domain.RegistrationMessage) (*domain.ConfirmationMessage, error) {
+	d.registration.register(registration.Commands())
 	return domain.NewConfirmationMessage(d.currentUser, d.trigger, d.onlineUsers.All()), nil
 }
 
 func (d *defaultDispatcherRelay) Send(packet *domain.ClientMessage) error {
-	return d.clientMessageProducer.Produce(packet)
+	atomic.AddInt64(&d.registration.replies, 1)
+	err := d.clientMessageProducer.Produce(packet)
+	if err != nil {
+		atomic.AddInt64(&d.registration.replies, -1)
+	}
+	return err
 }
 
+// Recv returns the next message dispatched to the bot, the previous one is handled once the bot asks for the next one
 func (d *defaultDispatcherRelay) Recv() (domain.ServerMessage, error) {
-	return d.serverMessageConsumer.Consume(d.ctx)
+	if d.handling {
+		d.handling = false
+		atomic.AddInt64(&d.registration.messages, -1)
+	}
+	m, err := d.serverMessageConsumer.Consume(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.handling = true
+	return m, nil
 }
 
 func (d *defaultDispatcherRelay) Done() <-chan struct{} {
@@ -33,17 +53,20 @@ func (d *defaultDispatcherRelay) Done() <-chan struct{} {
 }
 
 func (d *defaultDispatcherRelay) Err() error {
-	return d.ctx.Err()
+	return context.Cause(d.ctx)
 }
 
 var _ rpc.DispatcherRelay = (*defaultDispatcherRelay)(nil)
 
-func NewDefaultDispatcherRelay(ctx context.Context, onlineUsers domain.UserList, trigger string, currentUser *domain.User, clientMessageProducer queue.Producer[*domain.ClientMessage], serverMessageConsumer queue.Consumer[domain.ServerMessage]) rpc.DispatcherRelay {
+// NewDefaultDispatcherRelay returns a relay for a bot running in the same process as its connector.
+// What the bot registers goes to registration, which must be shared with the connector's relay
+func NewDefaultDispatcherRelay(ctx context.Context, onlineUsers domain.UserList, trigger string, currentUser *domain.User, registration *Registration, clientMessageProducer queue.Producer[*domain.ClientMessage], serverMessageConsumer queue.Consumer[domain.ServerMessage]) rpc.DispatcherRelay {
 	return &defaultDispatcherRelay{
-		ctx:                   ctx,
+		ctx:                   registration.session(ctx),
 		onlineUsers:           onlineUsers,
 		trigger:               trigger,
 		currentUser:           currentUser,
+		registration:          registration,
 		clientMessageProducer: clientMessageProducer,
 		serverMessageConsumer: serverMessageConsumer,
 	}
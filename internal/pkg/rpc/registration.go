@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+	"sync/atomic"
+)
+
+// Registration carries what a bot registers to a connector running in the same process.
+// It is shared by the bot's relay and the connector's relay
+type Registration struct {
+	m         sync.RWMutex
+	commands  domain.CommandList
+	closed    chan struct{}
+	closeOnce sync.Once
+	reason    error
+	// messages counts the messages dispatched to the bot that it hasn't handled yet
+	messages int64
+	// replies counts the replies sent by the bot that the connector hasn't handled yet
+	replies int64
+}
+
+func NewRegistration() *Registration {
+	return &Registration{commands: domain.NewCommandList(), closed: make(chan struct{})}
+}
+
+// close ends the session of the bot, its relay fails with reason
+func (r *Registration) close(reason error) {
+	r.closeOnce.Do(func() {
+		r.m.Lock()
+		r.reason = reason
+		r.m.Unlock()
+		close(r.closed)
+	})
+}
+
+// session returns a context cancelled once parent is done or the registration is closed, with the reason it was closed
+func (r *Registration) session(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancelCause(parent)
+	go func() {
+		select {
+		case <-r.closed:
+			r.m.RLock()
+			cancel(r.reason)
+			r.m.RUnlock()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx
+}
+
+func (r *Registration) pendingMessages() int {
+	return int(atomic.LoadInt64(&r.messages))
+}
+
+func (r *Registration) pendingReplies() int {
+	return int(atomic.LoadInt64(&r.replies))
+}
+
+func (r *Registration) register(commands []*domain.Command) {
+	for _, cmd := range commands {
+		r.commands.Add(cmd)
+	}
+}
@@ -5,29 +5,42 @@ import (
 	"github.com/raf924/bot/v2/pkg"
 	"github.com/raf924/bot/v2/pkg/bot/permissions"
 	botConfig "github.com/raf924/bot/v2/pkg/config/bot"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/command"
 	"github.com/raf924/connector-sdk/rpc"
+	"log/slog"
+	"os"
 )
 
 func NewBot(config botConfig.Config) pkg.Runnable {
-	var userPermissionManager permissions.PermissionManager
-	var commandPermissionManager permissions.PermissionManager
-	if config.Users.AllowAll {
-		userPermissionManager = permissions.NewNoCheckPermissionManager()
-		commandPermissionManager = permissions.NewNoCheckPermissionManager()
-	} else {
-		userPermissionManager = permissions.GetManager(config.Users.Permissions)
-		commandPermissionManager = permissions.GetManager(config.Commands.Permissions)
+	return NewBotWithLogger(config, nil)
+}
+
+// NewBotWithLogger returns a bot logging to logger, or to stderr as config.Log describes when it is nil
+func NewBotWithLogger(config botConfig.Config, logger *slog.Logger) pkg.Runnable {
+	if logger == nil {
+		logger = logging.New(config.Log, os.Stderr)
 	}
+	userPermissionManager, commandPermissionManager := GetPermissionManagers(config, logger)
 	return bot.NewBot(
 		config,
 		userPermissionManager,
 		commandPermissionManager,
 		GetDispatcherRelay(config),
 		command.GetCommandList(),
+		logger,
 	)
 }
 
+// GetPermissionManagers returns the user and the command permission managers described by config
+func GetPermissionManagers(config botConfig.Config, logger *slog.Logger) (permissions.PermissionManager, permissions.PermissionManager) {
+	if config.Users.AllowAll {
+		return permissions.NewNoCheckPermissionManager(), permissions.NewNoCheckPermissionManager()
+	}
+	logger = logging.OrDefault(logger)
+	return permissions.GetManager(config.Users.Permissions, logger), permissions.GetManager(config.Commands.Permissions, logger)
+}
+
 func GetDispatcherRelay(config botConfig.Config) rpc.DispatcherRelay {
 	for relayKey, relayConfig := range config.Connector {
 		relayBuilder := rpc.GetDispatcherRelay(relayKey)
@@ -39,3 +52,4 @@ func GetDispatcherRelay(config botConfig.Config) rpc.DispatcherRelay {
 }
 
 var _ = NewBot
+var _ = NewBotWithLogger
@@ -2,7 +2,9 @@ package permissions
 
 import (
 	botConfig "github.com/raf924/bot/v2/pkg/config/bot"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/domain"
+	"log/slog"
 )
 
 var permissionFormats = map[string]ManagerBuilder{}
@@ -20,18 +22,26 @@ type PermissionManager interface {
 	PermissionWriter
 }
 
+// PermissionPersister is implemented by PermissionManagers that can save their permissions, the bot persists them when it stops
+type PermissionPersister interface {
+	Persist() error
+}
+
 type ManagerBuilder func(location string) PermissionManager
 
 func Manage(format string, builder ManagerBuilder) {
-	println("Permission format:", format)
 	permissionFormats[format] = builder
 }
 
-func GetManager(config botConfig.PermissionConfig) PermissionManager {
+// GetManager returns the manager of the permissions described by config, logging to logger, or to the default logger when it is nil, which one it builds
+func GetManager(config botConfig.PermissionConfig, logger *slog.Logger) PermissionManager {
+	logger = logging.OrDefault(logger)
 	builder, ok := permissionFormats[config.Format]
 	if !ok {
+		logger.Warn("unknown permission format", "format", config.Format)
 		return nil
 	}
+	logger.Debug("loading permissions", "format", config.Format, "location", config.Location)
 	return builder(config.Location)
 }
 
@@ -49,3 +59,9 @@ func (n *noCheckPermissionManager) SetPermission(string, domain.Permission) erro
 func NewNoCheckPermissionManager() PermissionManager {
 	return &noCheckPermissionManager{}
 }
+
+// Checks tells whether manager looks up actual permissions rather than granting every one
+func Checks(manager PermissionManager) bool {
+	_, noCheck := manager.(*noCheckPermissionManager)
+	return !noCheck
+}
@@ -0,0 +1,128 @@
+package bottest
+
+import (
+	"context"
+	"fmt"
+	"github.com/raf924/bot/v2/internal/pkg/bot"
+	"github.com/raf924/bot/v2/pkg/bot/permissions"
+	botConfig "github.com/raf924/bot/v2/pkg/config/bot"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"testing"
+	"time"
+)
+
+type greetCommand struct {
+	command.NoOpCommand
+	executor command.Executor
+}
+
+func (g *greetCommand) Init(executor command.Executor) error {
+	g.executor = executor
+	return nil
+}
+
+func (g *greetCommand) Name() string {
+	return "greet"
+}
+
+func (g *greetCommand) Execute(message *domain.CommandMessage) ([]*domain.ClientMessage, error) {
+	greeting := fmt.Sprintf("hello %s", message.Sender().Nick())
+	if g.executor.UserHasPermission(message.Sender(), domain.IsAdmin) {
+		greeting += ", boss"
+	}
+	return []*domain.ClientMessage{domain.NewClientMessage(greeting, message.Sender(), message.Private())}, nil
+}
+
+func (g *greetCommand) OnUserEvent(event *domain.UserEvent) ([]*domain.ClientMessage, error) {
+	if event.EventType() != domain.UserJoined {
+		return nil, nil
+	}
+	return []*domain.ClientMessage{domain.NewClientMessage(fmt.Sprintf("welcome %s", event.User().Nick()), nil, false)}, nil
+}
+
+func TestHarness(t *testing.T) {
+	alice := NewUser("alice", domain.RegularUser)
+	h := StartWithConfig(t, Config{
+		Bot:   botConfig.Config{Users: botConfig.UserConfig{AllowAll: true}},
+		Users: []*domain.User{alice},
+	}, &greetCommand{})
+	h.Say(t, alice, "!greet")
+	if reply := h.ExpectReply(t, "hello alice, boss"); reply.Private() {
+		t.Fatal("expected a public reply")
+	}
+	h.SayPrivately(t, alice, "!greet")
+	if reply := h.ExpectReply(t, "hello alice, boss"); !reply.Private() {
+		t.Fatal("expected a private reply")
+	}
+	h.Join(NewUser("carol", domain.RegularUser))
+	h.ExpectReply(t, "welcome carol")
+	h.Say(t, alice, "hello")
+	h.ExpectNoReply(t, 50*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := h.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHarness_Subscription(t *testing.T) {
+	alice := NewUser("alice", domain.RegularUser)
+	h := StartWithConfig(t, Config{
+		Bot: botConfig.Config{
+			Users:        botConfig.UserConfig{AllowAll: true},
+			Subscription: &dispatch.Subscription{},
+		},
+	}, &greetCommand{})
+	h.Join(NewUser("carol", domain.RegularUser))
+	h.Say(t, alice, "!greet")
+	h.ExpectReply(t, "hello alice, boss")
+}
+
+func TestDispatcherRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	relay := NewDispatcherRelay(NewUser("bot", domain.RegularUser), "!")
+	t.Cleanup(relay.Close)
+	b := bot.NewBot(
+		botConfig.Config{Trigger: "!", Users: botConfig.UserConfig{AllowAll: true}},
+		permissions.NewNoCheckPermissionManager(),
+		permissions.NewNoCheckPermissionManager(),
+		relay,
+		command.NewCommandList(&greetCommand{}),
+		nil,
+	)
+	if err := b.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	registered := false
+	for _, cmd := range relay.Registration(t).Commands() {
+		registered = registered || cmd.Name() == "greet"
+	}
+	if !registered {
+		t.Fatal("expected greet to be registered")
+	}
+	alice := NewUser("alice", domain.RegularUser)
+	relay.Command(t, alice, "greet")
+	relay.ExpectReply(t, "hello alice, boss")
+	relay.Join(t, NewUser("carol", domain.RegularUser))
+	relay.ExpectReply(t, "welcome carol")
+}
+
+func TestExecutor(t *testing.T) {
+	executor := NewExecutor(NewUser("bot", domain.RegularUser), "!")
+	alice := NewUser("alice", domain.RegularUser)
+	executor.SetPermission(alice, domain.IsAdmin)
+	greet := &greetCommand{}
+	if err := greet.Init(executor); err != nil {
+		t.Fatal(err)
+	}
+	replies, err := greet.Execute(domain.NewCommandMessage("greet", nil, "", alice, false, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0].Message() != "hello alice, boss" {
+		t.Fatalf("unexpected replies %v", replies)
+	}
+}
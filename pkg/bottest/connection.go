@@ -0,0 +1,172 @@
+package bottest
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Timeout is how long the Expect helpers wait for a message
+var Timeout = time.Second
+
+var _ rpc.ConnectionRelay = (*Connection)(nil)
+
+// Connection is an in-memory ConnectionRelay. Tests speak as chat users and read what the connector sends
+type Connection struct {
+	m        sync.Mutex
+	users    domain.UserList
+	botUser  *domain.User
+	onJoin   func(user *domain.User, timestamp time.Time)
+	onLeft   func(user *domain.User, timestamp time.Time)
+	messages chan *domain.ChatMessage
+	replies  chan *domain.ClientMessage
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// NewConnection returns a Connection whose chat already has users
+func NewConnection(users ...*domain.User) *Connection {
+	return &Connection{
+		users:    domain.NewUserList(users...),
+		messages: make(chan *domain.ChatMessage),
+		replies:  make(chan *domain.ClientMessage, 256),
+		closed:   make(chan struct{}),
+	}
+}
+
+// NewUser returns an online user whose id is its nick
+func NewUser(nick string, role domain.UserRole) *domain.User {
+	return domain.NewOnlineUser(nick, nick, role, time.Now())
+}
+
+func (c *Connection) Connect(nick string) (*domain.User, domain.UserList, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.botUser = c.users.Find(nick)
+	if c.botUser == nil {
+		c.botUser = NewUser(nick, domain.RegularUser)
+		c.users.Add(c.botUser)
+	}
+	return c.botUser, c.users, nil
+}
+
+func (c *Connection) Recv() (*domain.ChatMessage, error) {
+	select {
+	case message := <-c.messages:
+		return message, nil
+	case <-c.closed:
+		return nil, io.EOF
+	}
+}
+
+func (c *Connection) Send(message *domain.ClientMessage) error {
+	select {
+	case c.replies <- message:
+		return nil
+	case <-c.closed:
+		return io.ErrClosedPipe
+	}
+}
+
+func (c *Connection) OnUserJoin(f func(user *domain.User, timestamp time.Time)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.onJoin = f
+}
+
+func (c *Connection) OnUserLeft(f func(user *domain.User, timestamp time.Time)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.onLeft = f
+}
+
+// Close ends the connection, the connector receives io.EOF
+func (c *Connection) Close() {
+	c.once.Do(func() {
+		close(c.closed)
+	})
+}
+
+// Users returns the users of the chat
+func (c *Connection) Users() []*domain.User {
+	return c.users.All()
+}
+
+func (c *Connection) say(t testing.TB, user *domain.User, text string, private bool) {
+	t.Helper()
+	c.m.Lock()
+	var recipients []*domain.User
+	if private && c.botUser != nil {
+		recipients = []*domain.User{c.botUser}
+	}
+	mentions := private || (c.botUser != nil && containsWord(text, c.botUser.Nick()))
+	c.m.Unlock()
+	message := domain.NewChatMessage(text, user, recipients, mentions, private, time.Now(), true)
+	select {
+	case c.messages <- message:
+	case <-c.closed:
+		t.Fatal("the connection is closed")
+	case <-time.After(Timeout):
+		t.Fatal("the connector didn't receive the message")
+	}
+}
+
+// Say sends text to the chat as user
+func (c *Connection) Say(t testing.TB, user *domain.User, text string) {
+	t.Helper()
+	c.say(t, user, text, false)
+}
+
+// SayPrivately sends text to the connector privately as user
+func (c *Connection) SayPrivately(t testing.TB, user *domain.User, text string) {
+	t.Helper()
+	c.say(t, user, text, true)
+}
+
+// Join makes user join the chat
+func (c *Connection) Join(user *domain.User) {
+	c.users.Add(user)
+	c.m.Lock()
+	onJoin := c.onJoin
+	c.m.Unlock()
+	if onJoin != nil {
+		onJoin(user, time.Now())
+	}
+}
+
+// Leave makes user leave the chat
+func (c *Connection) Leave(user *domain.User) {
+	c.users.Remove(user)
+	c.m.Lock()
+	onLeft := c.onLeft
+	c.m.Unlock()
+	if onLeft != nil {
+		onLeft(user, time.Now())
+	}
+}
+
+// NextReply waits for the next message sent by the connector
+func (c *Connection) NextReply(ctx context.Context) (*domain.ClientMessage, error) {
+	select {
+	case reply := <-c.replies:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ExpectReply fails the test unless the next message sent by the connector is text
+func (c *Connection) ExpectReply(t testing.TB, text string) *domain.ClientMessage {
+	t.Helper()
+	return expectReply(t, c.NextReply, text)
+}
+
+// ExpectNoReply fails the test if the connector sends a message within d
+func (c *Connection) ExpectNoReply(t testing.TB, d time.Duration) {
+	t.Helper()
+	expectNoReply(t, c.NextReply, d)
+}
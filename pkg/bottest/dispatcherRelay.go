@@ -0,0 +1,150 @@
+package bottest
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ rpc.DispatcherRelay = (*DispatcherRelay)(nil)
+
+// DispatcherRelay is an in-memory DispatcherRelay playing the connector's part so that a bot can be tested on its own
+type DispatcherRelay struct {
+	ctx          context.Context
+	cancel       context.CancelFunc
+	botUser      *domain.User
+	users        domain.UserList
+	trigger      string
+	registration chan *domain.RegistrationMessage
+	messages     chan domain.ServerMessage
+	replies      chan *domain.ClientMessage
+}
+
+// NewDispatcherRelay returns a DispatcherRelay telling the bot that it is botUser, that users are online and that commands start with trigger
+func NewDispatcherRelay(botUser *domain.User, trigger string, users ...*domain.User) *DispatcherRelay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DispatcherRelay{
+		ctx:          ctx,
+		cancel:       cancel,
+		botUser:      botUser,
+		users:        domain.NewUserList(append([]*domain.User{botUser}, users...)...),
+		trigger:      trigger,
+		registration: make(chan *domain.RegistrationMessage, 1),
+		messages:     make(chan domain.ServerMessage),
+		replies:      make(chan *domain.ClientMessage, 256),
+	}
+}
+
+func (d *DispatcherRelay) Connect(registration *domain.RegistrationMessage) (*domain.ConfirmationMessage, error) {
+	select {
+	case d.registration <- registration:
+	default:
+	}
+	return domain.NewConfirmationMessage(d.botUser, d.trigger, d.users.All()), nil
+}
+
+func (d *DispatcherRelay) Send(message *domain.ClientMessage) error {
+	select {
+	case d.replies <- message:
+		return nil
+	case <-d.ctx.Done():
+		return d.ctx.Err()
+	}
+}
+
+func (d *DispatcherRelay) Recv() (domain.ServerMessage, error) {
+	select {
+	case message := <-d.messages:
+		return message, nil
+	case <-d.ctx.Done():
+		return nil, d.ctx.Err()
+	}
+}
+
+func (d *DispatcherRelay) Done() <-chan struct{} {
+	return d.ctx.Done()
+}
+
+func (d *DispatcherRelay) Err() error {
+	return d.ctx.Err()
+}
+
+// Close disconnects the bot
+func (d *DispatcherRelay) Close() {
+	d.cancel()
+}
+
+// Registration waits for the commands the bot registered
+func (d *DispatcherRelay) Registration(t testing.TB) *domain.RegistrationMessage {
+	t.Helper()
+	select {
+	case registration := <-d.registration:
+		return registration
+	case <-time.After(Timeout):
+		t.Fatal("expected the bot to register")
+	}
+	return nil
+}
+
+// Dispatch sends message to the bot
+func (d *DispatcherRelay) Dispatch(t testing.TB, message domain.ServerMessage) {
+	t.Helper()
+	select {
+	case d.messages <- message:
+	case <-d.ctx.Done():
+		t.Fatal("the relay is closed")
+	case <-time.After(Timeout):
+		t.Fatal("the bot didn't receive the message")
+	}
+}
+
+// Say sends text to the bot as a public chat message from user
+func (d *DispatcherRelay) Say(t testing.TB, user *domain.User, text string) {
+	t.Helper()
+	d.Dispatch(t, domain.NewChatMessage(text, user, nil, containsWord(text, d.botUser.Nick()), false, time.Now(), true))
+}
+
+// Command sends a command to the bot as user
+func (d *DispatcherRelay) Command(t testing.TB, user *domain.User, name string, args ...string) {
+	t.Helper()
+	d.Dispatch(t, domain.NewCommandMessage(name, args, strings.Join(args, " "), user, false, time.Now()))
+}
+
+// Join tells the bot that user joined the chat
+func (d *DispatcherRelay) Join(t testing.TB, user *domain.User) {
+	t.Helper()
+	d.users.Add(user)
+	d.Dispatch(t, domain.NewUserEvent(user, domain.UserJoined, time.Now()))
+}
+
+// Leave tells the bot that user left the chat
+func (d *DispatcherRelay) Leave(t testing.TB, user *domain.User) {
+	t.Helper()
+	d.users.Remove(user)
+	d.Dispatch(t, domain.NewUserEvent(user, domain.UserLeft, time.Now()))
+}
+
+// NextReply waits for the next message sent by the bot
+func (d *DispatcherRelay) NextReply(ctx context.Context) (*domain.ClientMessage, error) {
+	select {
+	case reply := <-d.replies:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ExpectReply fails the test unless the next message sent by the bot is text
+func (d *DispatcherRelay) ExpectReply(t testing.TB, text string) *domain.ClientMessage {
+	t.Helper()
+	return expectReply(t, d.NextReply, text)
+}
+
+// ExpectNoReply fails the test if the bot sends a message within duration
+func (d *DispatcherRelay) ExpectNoReply(t testing.TB, duration time.Duration) {
+	t.Helper()
+	expectNoReply(t, d.NextReply, duration)
+}
@@ -0,0 +1,73 @@
+package bottest
+
+import (
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"sync"
+)
+
+var _ command.Executor = (*Executor)(nil)
+
+// Executor is a command.Executor to initialize a command with in unit tests
+type Executor struct {
+	m           sync.RWMutex
+	botUser     *domain.User
+	trigger     string
+	users       domain.UserList
+	apiKeys     map[string]string
+	permissions map[string]domain.Permission
+}
+
+// NewExecutor returns an Executor for the bot botUser, with users online
+func NewExecutor(botUser *domain.User, trigger string, users ...*domain.User) *Executor {
+	return &Executor{
+		botUser:     botUser,
+		trigger:     trigger,
+		users:       domain.NewUserList(append([]*domain.User{botUser}, users...)...),
+		apiKeys:     map[string]string{},
+		permissions: map[string]domain.Permission{},
+	}
+}
+
+// SetApiKey makes key available to commands under name
+func (e *Executor) SetApiKey(name string, key string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.apiKeys[name] = key
+}
+
+// SetPermission gives permission to user
+func (e *Executor) SetPermission(user *domain.User, permission domain.Permission) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.permissions[user.Id()] = permission
+}
+
+func (e *Executor) BotUser() *domain.User {
+	return e.botUser
+}
+
+func (e *Executor) ApiKeys() map[string]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	apiKeys := make(map[string]string, len(e.apiKeys))
+	for name, key := range e.apiKeys {
+		apiKeys[name] = key
+	}
+	return apiKeys
+}
+
+func (e *Executor) OnlineUsers() domain.UserList {
+	return domain.ImmutableUserList(e.users)
+}
+
+// UserHasPermission tells whether the permission given to user with SetPermission includes permission
+func (e *Executor) UserHasPermission(user *domain.User, permission domain.Permission) bool {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.permissions[user.Id()].Has(permission)
+}
+
+func (e *Executor) Trigger() string {
+	return e.trigger
+}
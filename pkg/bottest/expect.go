@@ -0,0 +1,44 @@
+package bottest
+
+import (
+	"context"
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+func containsWord(text string, word string) bool {
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
+
+func expectReply(t testing.TB, next func(ctx context.Context) (*domain.ClientMessage, error), text string) *domain.ClientMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	reply, err := next(ctx)
+	if err != nil {
+		t.Fatalf("expected reply %q: %v", text, err)
+	}
+	if reply.Message() != text {
+		t.Fatalf("expected reply %q got %q", text, reply.Message())
+	}
+	return reply
+}
+
+func expectNoReply(t testing.TB, next func(ctx context.Context) (*domain.ClientMessage, error), d time.Duration) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	if reply, err := next(ctx); err == nil {
+		t.Fatalf("expected no reply got %q", reply.Message())
+	}
+}
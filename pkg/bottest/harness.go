@@ -0,0 +1,104 @@
+package bottest
+
+import (
+	"context"
+	"github.com/raf924/bot/v2/internal/pkg/bot"
+	"github.com/raf924/bot/v2/internal/pkg/connector"
+	internalRpc "github.com/raf924/bot/v2/internal/pkg/rpc"
+	publicBot "github.com/raf924/bot/v2/pkg/bot"
+	botConfig "github.com/raf924/bot/v2/pkg/config/bot"
+	connectorConfig "github.com/raf924/bot/v2/pkg/config/connector"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/command"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/queue"
+	"io"
+	"testing"
+	"time"
+)
+
+// Harness runs commands in a real bot behind a real connector talking to a Connection
+type Harness struct {
+	*Connection
+	BotUser   *domain.User
+	connector *connector.Connector
+}
+
+// Config configures the connector and the bot of a Harness. The connector's name defaults to "bot", its trigger to "!"
+// and the bot's trigger to the connector's
+type Config struct {
+	Connector connectorConfig.Config
+	Bot       botConfig.Config
+	// Users are online when the harness starts
+	Users []*domain.User
+}
+
+// Start runs commands in a harness with the default configuration, letting every user run every command
+func Start(t testing.TB, commands ...command.Command) *Harness {
+	t.Helper()
+	return StartWithConfig(t, Config{Bot: botConfig.Config{Users: botConfig.UserConfig{AllowAll: true}}}, commands...)
+}
+
+// StartWithConfig runs botCommands in a harness configured by config. Everything stops when the test ends
+func StartWithConfig(t testing.TB, config Config, botCommands ...command.Command) *Harness {
+	t.Helper()
+	if len(config.Connector.Name) == 0 {
+		config.Connector.Name = "bot"
+	}
+	if len(config.Connector.Trigger) == 0 {
+		config.Connector.Trigger = "!"
+	}
+	if len(config.Bot.Trigger) == 0 {
+		config.Bot.Trigger = config.Connector.Trigger
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	botUser := NewUser(config.Connector.Name, domain.RegularUser)
+	connection := NewConnection(append([]*domain.User{botUser}, config.Users...)...)
+	t.Cleanup(func() {
+		cancel()
+		connection.Close()
+	})
+	clientMessageQueue := queue.NewQueue[*domain.ClientMessage]()
+	serverMessageQueue := queue.NewQueue[domain.ServerMessage]()
+	clientMessageConsumer, err := clientMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverMessageConsumer, err := serverMessageQueue.NewConsumer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration := internalRpc.NewRegistration()
+	botLogger := logging.New(config.Bot.Log, io.Discard)
+	userPermissionManager, commandPermissionManager := publicBot.GetPermissionManagers(config.Bot, botLogger)
+	b := bot.NewBot(
+		config.Bot,
+		userPermissionManager,
+		commandPermissionManager,
+		internalRpc.NewDefaultDispatcherRelay(ctx, domain.NewUserList(connection.Users()...), config.Connector.Trigger, botUser, registration, clientMessageQueue, serverMessageConsumer),
+		command.NewCommandList(botCommands...),
+		botLogger,
+	)
+	ctr := connector.NewConnector(
+		config.Connector,
+		connection,
+		internalRpc.NewDefaultConnectorRelay(b, registration, clientMessageConsumer, serverMessageQueue),
+		logging.New(config.Connector.Log, io.Discard),
+	)
+	if err := ctr.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(Timeout)
+	for len(ctr.QueueDepths()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the bot didn't connect to the connector")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return &Harness{Connection: connection, BotUser: botUser, connector: ctr}
+}
+
+// Stop stops the connector and the bot once their pending messages are sent
+func (h *Harness) Stop(ctx context.Context) error {
+	return h.connector.Stop(ctx)
+}
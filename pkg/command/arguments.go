@@ -0,0 +1,120 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ArgumentType string
+
+const (
+	StringArgument ArgumentType = "string"
+	IntArgument    ArgumentType = "int"
+	NumberArgument ArgumentType = "number"
+	// DurationArgument accepts a Go duration such as 10m or a whole number of seconds
+	DurationArgument ArgumentType = "duration"
+)
+
+type Argument struct {
+	Name string
+	Type ArgumentType
+	// Optional arguments may be omitted, they must come after the required ones
+	Optional bool
+	// Variadic arguments swallow all the remaining args and must come last
+	Variadic bool
+}
+
+func (a Argument) String() string {
+	name := a.Name
+	if a.Variadic {
+		name += "..."
+	}
+	if a.Optional {
+		return fmt.Sprintf("[%s]", name)
+	}
+	return fmt.Sprintf("<%s>", name)
+}
+
+func (a Argument) validate(value string) error {
+	var err error
+	switch a.Type {
+	case IntArgument:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case NumberArgument:
+		_, err = strconv.ParseFloat(value, 64)
+	case DurationArgument:
+		_, err = ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%s must be a valid %s", a.Name, a.Type)
+	}
+	return nil
+}
+
+// Documented can be implemented by a command.Command to describe itself to users
+// and have its arguments checked before it is executed
+type Documented interface {
+	Description() string
+	// Usage may return an empty string in which case it is built from Arguments
+	Usage() string
+	Arguments() []Argument
+}
+
+// BuildUsage returns the usage line of a command named name accepting arguments
+func BuildUsage(name string, arguments []Argument) string {
+	parts := []string{name}
+	for _, argument := range arguments {
+		parts = append(parts, argument.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// UsageOf returns the usage line of a Documented command
+func UsageOf(name string, documented Documented) string {
+	if usage := documented.Usage(); len(usage) > 0 {
+		return usage
+	}
+	return BuildUsage(name, documented.Arguments())
+}
+
+// ValidateArguments checks the arity and the types of args against arguments
+func ValidateArguments(arguments []Argument, args []string) error {
+	for i, argument := range arguments {
+		if i >= len(args) {
+			if argument.Optional {
+				return nil
+			}
+			return fmt.Errorf("missing %s", argument.Name)
+		}
+		if argument.Variadic {
+			for _, arg := range args[i:] {
+				if err := argument.validate(arg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := argument.validate(args[i]); err != nil {
+			return err
+		}
+	}
+	if len(args) > len(arguments) {
+		return fmt.Errorf("too many arguments")
+	}
+	return nil
+}
+
+// ParseDuration parses a Go duration or falls back to a whole number of seconds
+func ParseDuration(value string) (time.Duration, error) {
+	duration, err := time.ParseDuration(value)
+	if err == nil {
+		return duration, nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
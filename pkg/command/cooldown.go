@@ -0,0 +1,17 @@
+package command
+
+import "time"
+
+// Cooldowns sets how long a command waits between two invocations
+type Cooldowns struct {
+	// Command is shared by every user
+	Command time.Duration `yaml:"command"`
+	// User applies to each user separately
+	User time.Duration `yaml:"user"`
+}
+
+// CoolingDown can be implemented by a command.Command to declare its cooldowns.
+// The cooldowns set in the bot's configuration take precedence
+type CoolingDown interface {
+	Cooldowns() Cooldowns
+}
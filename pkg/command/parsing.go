@@ -1,8 +1,12 @@
 package command
 
 import (
+	"errors"
+	"fmt"
 	"github.com/raf924/connector-sdk/domain"
 	"sort"
+	"strings"
+	"unicode"
 )
 
 func Is(possibleCommand string, cmd *domain.Command) bool {
@@ -20,3 +24,59 @@ func Is(possibleCommand string, cmd *domain.Command) bool {
 	}
 	return false
 }
+
+var ErrUnbalancedQuotes = errors.New("unbalanced quotes")
+
+var ErrTrailingEscape = errors.New("trailing escape character")
+
+// Tokenize splits argString into arguments the way a POSIX shell would:
+// runs of whitespace separate arguments, double and single quotes group words,
+// and a backslash escapes the next character (except inside single quotes)
+func Tokenize(argString string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inToken := false
+	escaped := false
+	for _, r := range argString {
+		switch {
+		case escaped:
+			if quote == '"' && r != '"' && r != '\\' {
+				current.WriteRune('\\')
+			}
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				args = append(args, current.String())
+				current.Reset()
+				inToken = false
+			}
+		default:
+			current.WriteRune(r)
+			inToken = true
+		}
+	}
+	if escaped {
+		return nil, ErrTrailingEscape
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("%w: missing closing %c", ErrUnbalancedQuotes, quote)
+	}
+	if inToken {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,83 @@
+package command
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  nil,
+		},
+		{
+			name:  "collapses whitespace",
+			input: "  a   b\tc ",
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			name:  "double quotes",
+			input: `"buy milk" 10m`,
+			want:  []string{"buy milk", "10m"},
+		},
+		{
+			name:  "single quotes keep backslashes",
+			input: `'a\b' c`,
+			want:  []string{`a\b`, "c"},
+		},
+		{
+			name:  "escaped space",
+			input: `a\ b c`,
+			want:  []string{"a b", "c"},
+		},
+		{
+			name:  "escaped quote inside double quotes",
+			input: `"say \"hi\""`,
+			want:  []string{`say "hi"`},
+		},
+		{
+			name:  "empty quoted argument",
+			input: `a "" b`,
+			want:  []string{"a", "", "b"},
+		},
+		{
+			name:  "adjacent quoted parts",
+			input: `foo"bar baz"'qux'`,
+			want:  []string{"foobar bazqux"},
+		},
+		{
+			name:    "unbalanced double quote",
+			input:   `"buy milk 10m`,
+			wantErr: ErrUnbalancedQuotes,
+		},
+		{
+			name:    "unbalanced single quote",
+			input:   `it's`,
+			wantErr: ErrUnbalancedQuotes,
+		},
+		{
+			name:    "trailing escape",
+			input:   `a\`,
+			wantErr: ErrTrailingEscape,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tokenize(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Tokenize() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package command
+
+import "sort"
+
+// Distance returns the Levenshtein distance between a and b, counted in runes
+func Distance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// Suggest returns the names at most maxDistance edits away from word, closest first.
+// A name is only suggested if it is closer to word than word is long, so short words don't match everything
+func Suggest(word string, names []string, maxDistance int) []string {
+	distances := map[string]int{}
+	length := len([]rune(word))
+	for _, name := range names {
+		if _, ok := distances[name]; ok || name == word {
+			continue
+		}
+		if d := Distance(word, name); d <= maxDistance && d < length {
+			distances[name] = d
+		}
+	}
+	suggestions := make([]string, 0, len(distances))
+	for name := range distances {
+		suggestions = append(suggestions, name)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if distances[suggestions[i]] != distances[suggestions[j]] {
+			return distances[suggestions[i]] < distances[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	return suggestions
+}
@@ -0,0 +1,47 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"comand", "command", 1},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+	}
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"remind", "reminders", "roll", "r", "help", "remind"}
+	tests := []struct {
+		name        string
+		word        string
+		maxDistance int
+		want        []string
+	}{
+		{"closest first", "remindr", 2, []string{"remind", "reminders"}},
+		{"threshold", "remnd", 1, []string{"remind"}},
+		{"nothing close", "weather", 2, []string{}},
+		{"short word", "x", 2, []string{}},
+		{"exact match", "roll", 2, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Suggest(tt.word, names, tt.maxDistance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Suggest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
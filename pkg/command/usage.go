@@ -0,0 +1,18 @@
+package command
+
+import "strings"
+
+// FormatUsage packs a usage line and a description into the single usage string carried by domain.Command.
+// The usage comes first, the description follows on the next lines
+func FormatUsage(usage string, description string) string {
+	if len(description) == 0 {
+		return usage
+	}
+	return usage + "\n" + description
+}
+
+// ParseUsage splits a usage string built by FormatUsage back into its usage line and description
+func ParseUsage(usage string) (string, string) {
+	usage, description, _ := strings.Cut(usage, "\n")
+	return strings.TrimSpace(usage), strings.TrimSpace(description)
+}
@@ -1,5 +1,12 @@
 package bot
 
+import (
+	"github.com/raf924/bot/v2/pkg/command"
+	"github.com/raf924/bot/v2/pkg/dispatch"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/domain"
+)
+
 type PermissionConfig struct {
 	Format   string `yaml:"format"`
 	Location string `yaml:"location"`
@@ -13,12 +20,32 @@ type UserConfig struct {
 type CommandConfig struct {
 	Disabled    map[string]bool  `yaml:"disabled"`
 	Permissions PermissionConfig `yaml:"permissions"`
+	// Cooldowns maps command names to their cooldowns, overriding those declared by the commands
+	Cooldowns map[string]command.Cooldowns `yaml:"cooldowns"`
+	// CooldownBypass is the permission letting users ignore cooldowns, it defaults to admins.
+	// Nobody bypasses cooldowns when every user is allowed
+	CooldownBypass domain.Permission `yaml:"cooldownBypass"`
+}
+
+type MetricsConfig struct {
+	// Address is where /metrics is served, such as :9090. Metrics aren't served when it is empty
+	Address string `yaml:"address"`
 }
 
 type Config struct {
+	// Name identifies the bot to the connector. A bot connecting with the name of another replaces it,
+	// a connector requiring tokens only lets the bot given that name claim it
+	Name      string                 `yaml:"name"`
+	Version   string                 `yaml:"version"`
 	Connector map[string]interface{} `yaml:"connector"`
 	Trigger   string                 `yaml:"trigger"`
 	ApiKeys   map[string]string      `yaml:"apiKeys"`
 	Users     UserConfig             `yaml:"users"`
 	Commands  CommandConfig          `yaml:"commands"`
+	Metrics   MetricsConfig          `yaml:"metrics"`
+	Log       logging.Config         `yaml:"log"`
+	// Subscription restricts what the connector sends the bot, it receives everything when it is nil
+	Subscription *dispatch.Subscription `yaml:"subscription"`
+	// Token is presented to a connector requiring dispatchers to authenticate
+	Token string `yaml:"token"`
 }
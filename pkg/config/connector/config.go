@@ -1,8 +1,165 @@
 package connector
 
+import (
+	"github.com/raf924/bot/v2/pkg/logging"
+	"time"
+)
+
+// CollisionPolicy decides what happens when a dispatcher registers a name or an alias that is already taken
+type CollisionPolicy string
+
+const (
+	// FirstWins sends the command to the dispatcher that registered it first
+	FirstWins CollisionPolicy = "first"
+	// RejectNewcomer refuses dispatchers that register a name or an alias that is already taken
+	RejectNewcomer CollisionPolicy = "reject"
+	// Namespace requires ambiguous commands to be invoked as <dispatcher>:<command>
+	Namespace CollisionPolicy = "namespace"
+)
+
+// OverflowPolicy decides what happens when a dispatcher's queue is full
+type OverflowPolicy string
+
+const (
+	// Block waits for the dispatcher to catch up, slowing down the whole connector
+	Block OverflowPolicy = "block"
+	// DropOldest discards the oldest queued message to make room for the new one
+	DropOldest OverflowPolicy = "drop-oldest"
+	// Disconnect drops the dispatcher
+	Disconnect OverflowPolicy = "disconnect"
+)
+
+type DispatchConfig struct {
+	QueueSize int            `yaml:"queueSize"`
+	Overflow  OverflowPolicy `yaml:"overflow"`
+}
+
+// ThrottlePolicy decides what happens to outgoing messages when the rate limiter's queue is full
+type ThrottlePolicy string
+
+const (
+	// DropExcess discards the messages that don't fit in the queue
+	DropExcess ThrottlePolicy = "drop"
+	// Coalesce appends the message to the last queued message for the same recipient, dropping it if there is none
+	Coalesce ThrottlePolicy = "coalesce"
+)
+
+type RateConfig struct {
+	// Rate is the number of messages per second, 0 disables the limit
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+type RateLimitConfig struct {
+	Global       RateConfig     `yaml:"global"`
+	PerRecipient RateConfig     `yaml:"perRecipient"`
+	QueueSize    int            `yaml:"queueSize"`
+	Overflow     ThrottlePolicy `yaml:"overflow"`
+}
+
+type LengthUnit string
+
+const (
+	Bytes LengthUnit = "bytes"
+	Runes LengthUnit = "runes"
+)
+
+type MessageConfig struct {
+	// MaxLength is the longest message the connections accept unless they set their own, 0 disables splitting
+	MaxLength int        `yaml:"maxLength"`
+	Unit      LengthUnit `yaml:"unit"`
+	// MaxParts is how many parts of a split message are sent at once, the rest is sent on demand. 0 sends everything
+	MaxParts int `yaml:"maxParts"`
+}
+
+type ReconnectConfig struct {
+	// MaxAttempts is how many times the connector tries to reconnect before giving up, 0 disables reconnection and a negative value retries forever
+	MaxAttempts  int           `yaml:"maxAttempts"`
+	InitialDelay time.Duration `yaml:"initialDelay"`
+	MaxDelay     time.Duration `yaml:"maxDelay"`
+}
+
+type StatusConfig struct {
+	// Address is where the status server listens, such as :8080. The server is disabled when it is empty
+	Address string `yaml:"address"`
+}
+
+type RecordConfig struct {
+	// File is the JSON-lines file the conversation is appended to. Recording is disabled when it is empty
+	File string `yaml:"file"`
+}
+
+// ConnectionConfig describes one of the chat connections served by a connector
+type ConnectionConfig struct {
+	// Name tells the connection apart, it qualifies the ids and nicks of its users
+	Name string `yaml:"name"`
+	// Trigger overrides the connector's trigger on this connection
+	Trigger string                 `yaml:"trigger"`
+	Relay   map[string]interface{} `yaml:"relay"`
+	// MaxLength overrides the longest message the connector sends on this connection
+	MaxLength int        `yaml:"maxLength"`
+	Unit      LengthUnit `yaml:"unit"`
+}
+
+// BridgeRoute relays the messages of one connection to another
+type BridgeRoute struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Include is a regular expression the relayed messages must match, every message matches when it is empty
+	Include string `yaml:"include"`
+	// Exclude is a regular expression the relayed messages must not match
+	Exclude string `yaml:"exclude"`
+}
+
+type BridgeConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Format is how relayed messages look, {connection}, {nick} and {message} are replaced. It defaults to "[{connection}] <{nick}> {message}"
+	Format string `yaml:"format"`
+	// Announce relays the users joining and leaving
+	Announce bool `yaml:"announce"`
+	// Routes defaults to relaying every connection to every other one
+	Routes []BridgeRoute `yaml:"routes"`
+}
+
+// BotAuthConfig is the token of a bot that may only register some commands
+type BotAuthConfig struct {
+	// Name is the only name the bot may claim, no other token can claim it
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	// Commands are the names and aliases the bot may register
+	Commands []string `yaml:"commands"`
+}
+
+// AuthConfig lists the tokens dispatchers must present. Every dispatcher is accepted when there are none
+type AuthConfig struct {
+	// Tokens let a dispatcher register any command
+	Tokens []string        `yaml:"tokens"`
+	Bots   []BotAuthConfig `yaml:"bots"`
+}
+
+// SuggestionConfig sets how trigger-prefixed words that aren't commands get "did you mean" replies
+type SuggestionConfig struct {
+	Disabled bool `yaml:"disabled"`
+	// MaxDistance is the largest number of edits between the word and a suggested command, it defaults to 2
+	MaxDistance int `yaml:"maxDistance"`
+}
+
 type Config struct {
 	Name       string                 `yaml:"name"`
 	Bot        map[string]interface{} `yaml:"bot"`
 	Connection map[string]interface{} `yaml:"connection"`
 	Trigger    string                 `yaml:"trigger"`
+	Collisions CollisionPolicy        `yaml:"collisions"`
+	Dispatch   DispatchConfig         `yaml:"dispatch"`
+	RateLimit  RateLimitConfig        `yaml:"rateLimit"`
+	Messages   MessageConfig          `yaml:"messages"`
+	Reconnect  ReconnectConfig        `yaml:"reconnect"`
+	Status     StatusConfig           `yaml:"status"`
+	Log        logging.Config         `yaml:"log"`
+	Record     RecordConfig           `yaml:"record"`
+	// Connections replaces Connection to serve several chat connections at once
+	Connections []ConnectionConfig `yaml:"connections"`
+	Bridge      BridgeConfig       `yaml:"bridge"`
+	Auth        AuthConfig         `yaml:"auth"`
+	Suggestions SuggestionConfig   `yaml:"suggestions"`
 }
@@ -0,0 +1,232 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	rpc.RegisterConnectionRelay("console", newConsoleRelayFromConfig)
+}
+
+type ConsoleConfig struct {
+	// User is the nick of the user typing in the console, it defaults to "user"
+	User string          `yaml:"user"`
+	Role domain.UserRole `yaml:"role"`
+}
+
+const consoleHelp = `/join <nick>   a user joins
+/leave <nick>  a user leaves
+/as <nick>     speak as another online user
+/private       send private messages to the connector
+/public        send public messages
+/quit          end the session
+//text         send text starting with a slash`
+
+var _ rpc.ConnectionRelay = (*ConsoleRelay)(nil)
+
+// ConsoleRelay is a ConnectionRelay reading chat messages from a terminal and printing what the connector sends
+type ConsoleRelay struct {
+	in       *bufio.Scanner
+	out      io.Writer
+	outM     sync.Mutex
+	user     *domain.User
+	botUser  *domain.User
+	users    domain.UserList
+	private  bool
+	messages chan *domain.ChatMessage
+	m        sync.Mutex
+	onJoin   func(user *domain.User, timestamp time.Time)
+	onLeft   func(user *domain.User, timestamp time.Time)
+	err      error
+	started  bool
+}
+
+// NewConsoleRelay reads the messages of the user called nick from in and writes the connector's messages to out
+func NewConsoleRelay(nick string, role domain.UserRole, in io.Reader, out io.Writer) *ConsoleRelay {
+	if len(nick) == 0 {
+		nick = "user"
+	}
+	if len(role) == 0 {
+		role = domain.RegularUser
+	}
+	return &ConsoleRelay{
+		in:       bufio.NewScanner(in),
+		out:      out,
+		user:     domain.NewOnlineUser(nick, nick, role, time.Now()),
+		messages: make(chan *domain.ChatMessage),
+	}
+}
+
+func newConsoleRelayFromConfig(config interface{}) rpc.ConnectionRelay {
+	var consoleConfig ConsoleConfig
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return nil
+	}
+	if err := yaml.Unmarshal(data, &consoleConfig); err != nil {
+		return nil
+	}
+	return NewConsoleRelay(consoleConfig.User, consoleConfig.Role, os.Stdin, os.Stdout)
+}
+
+func (c *ConsoleRelay) printf(format string, args ...interface{}) {
+	c.outM.Lock()
+	defer c.outM.Unlock()
+	_, _ = fmt.Fprintf(c.out, format+"\n", args...)
+}
+
+func (c *ConsoleRelay) Connect(nick string) (*domain.User, domain.UserList, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.started {
+		return nil, nil, fmt.Errorf("the console can only be connected once")
+	}
+	c.started = true
+	c.botUser = domain.NewOnlineUser(nick, nick, domain.RegularUser, time.Now())
+	c.users = domain.NewUserList(c.botUser, c.user)
+	go c.read()
+	return c.botUser, c.users, nil
+}
+
+func (c *ConsoleRelay) read() {
+	for c.in.Scan() {
+		line := c.in.Text()
+		if strings.HasPrefix(line, "/") && !strings.HasPrefix(line, "//") {
+			if !c.command(strings.Fields(strings.TrimPrefix(line, "/"))) {
+				break
+			}
+			continue
+		}
+		line = strings.TrimPrefix(line, "/")
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		c.messages <- c.chatMessage(line)
+	}
+	c.m.Lock()
+	c.err = c.in.Err()
+	if c.err == nil {
+		c.err = io.EOF
+	}
+	c.m.Unlock()
+	close(c.messages)
+}
+
+func (c *ConsoleRelay) chatMessage(line string) *domain.ChatMessage {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var recipients []*domain.User
+	if c.private {
+		recipients = []*domain.User{c.botUser}
+	}
+	mentions := c.private || strings.Contains(line, c.botUser.Nick())
+	return domain.NewChatMessage(line, c.user, recipients, mentions, c.private, time.Now(), true)
+}
+
+// command runs a slash-command and tells whether the session goes on
+func (c *ConsoleRelay) command(fields []string) bool {
+	if len(fields) == 0 {
+		c.printf("%s", consoleHelp)
+		return true
+	}
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "quit":
+		return false
+	case "private", "public":
+		c.m.Lock()
+		c.private = name == "private"
+		c.m.Unlock()
+		c.printf("-- sending %s messages", name)
+	case "join", "leave", "as":
+		if len(args) != 1 {
+			c.printf("-- usage: /%s <nick>", name)
+			return true
+		}
+		c.userCommand(name, args[0])
+	default:
+		c.printf("%s", consoleHelp)
+	}
+	return true
+}
+
+func (c *ConsoleRelay) userCommand(name string, nick string) {
+	c.m.Lock()
+	user := c.users.Find(nick)
+	onJoin, onLeft := c.onJoin, c.onLeft
+	switch {
+	case name == "join" && user == nil:
+		user = domain.NewOnlineUser(nick, nick, domain.RegularUser, time.Now())
+		c.users.Add(user)
+	case name == "leave" && user != nil && user != c.botUser && user != c.user:
+		c.users.Remove(user)
+	case name == "as" && user != nil && user != c.botUser:
+		c.user = user
+		c.m.Unlock()
+		c.printf("-- speaking as %s", nick)
+		return
+	default:
+		c.m.Unlock()
+		c.printf("-- can't %s %s", name, nick)
+		return
+	}
+	c.m.Unlock()
+	if name == "join" {
+		c.printf("-- %s joined", nick)
+		if onJoin != nil {
+			onJoin(user, time.Now())
+		}
+		return
+	}
+	c.printf("-- %s left", nick)
+	if onLeft != nil {
+		onLeft(user, time.Now())
+	}
+}
+
+// Recv returns the next line typed in the console, io.EOF once the session is over
+func (c *ConsoleRelay) Recv() (*domain.ChatMessage, error) {
+	message, ok := <-c.messages
+	if ok {
+		return message, nil
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	return nil, c.err
+}
+
+func (c *ConsoleRelay) Send(message *domain.ClientMessage) error {
+	c.m.Lock()
+	nick := c.botUser.Nick()
+	c.m.Unlock()
+	switch {
+	case message.Emote():
+		c.printf("* %s %s", nick, message.Message())
+	case message.Private() && message.Recipient() != nil:
+		c.printf("[private to %s] <%s> %s", message.Recipient().Nick(), nick, message.Message())
+	default:
+		c.printf("<%s> %s", nick, message.Message())
+	}
+	return nil
+}
+
+func (c *ConsoleRelay) OnUserJoin(f func(user *domain.User, timestamp time.Time)) {
+	c.m.Lock()
+	c.onJoin = f
+	c.m.Unlock()
+}
+
+func (c *ConsoleRelay) OnUserLeft(f func(user *domain.User, timestamp time.Time)) {
+	c.m.Lock()
+	c.onLeft = f
+	c.m.Unlock()
+}
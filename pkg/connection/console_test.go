@@ -0,0 +1,56 @@
+package connection
+
+import (
+	"bytes"
+	"github.com/raf924/connector-sdk/domain"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleRelay(t *testing.T) {
+	var out bytes.Buffer
+	console := NewConsoleRelay("alice", "", strings.NewReader("/join bob\nhello\n/as bob\n/private\nhi\n//me\n/quit\nignored\n"), &out)
+	joined := make(chan string, 1)
+	console.OnUserJoin(func(user *domain.User, _ time.Time) {
+		joined <- user.Nick()
+	})
+	bot, users, err := console.Connect("bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bot.Nick() != "bot" || users.Find("alice") == nil {
+		t.Fatal("expected the bot and the console user to be online")
+	}
+	expected := []struct {
+		message string
+		sender  string
+		private bool
+	}{
+		{"hello", "alice", false},
+		{"hi", "bob", true},
+		{"/me", "bob", true},
+	}
+	for _, e := range expected {
+		message, err := console.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if message.Message() != e.message || message.Sender().Nick() != e.sender || message.Private() != e.private {
+			t.Fatalf("expected %q from %s (private: %v), got %q from %s (private: %v)", e.message, e.sender, e.private, message.Message(), message.Sender().Nick(), message.Private())
+		}
+	}
+	if _, err := console.Recv(); err != io.EOF {
+		t.Fatal("expected io.EOF, got", err)
+	}
+	if nick := <-joined; nick != "bob" {
+		t.Fatal("expected bob to join, got", nick)
+	}
+	if err := console.Send(domain.NewClientMessage("pong", bot, false)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "<bot> pong\n") {
+		t.Fatalf("expected the message to be printed, got %q", out.String())
+	}
+}
@@ -0,0 +1,36 @@
+package connection
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"time"
+)
+
+// Synthetic user events sent by the connector to its dispatchers, their user is the connector's own user
+const (
+	// ConnectionLost is sent when the connection to the chat service failed and the connector tries to reconnect
+	ConnectionLost domain.UserEventType = "CONNECTION_LOST"
+	// ConnectionRestored is sent once the connector is connected again
+	ConnectionRestored domain.UserEventType = "CONNECTION_RESTORED"
+)
+
+// Roster is the snapshot of the online users that a dispatcher receives when it is accepted and when a connection is restored.
+// The dispatcher must forget the users it knew, the UserJoined and UserLeft events that follow are deltas.
+// Only dispatchers declaring dispatch.Handshake.ConnectorMessages receive it
+type Roster struct {
+	users     []*domain.User
+	timestamp time.Time
+}
+
+func NewRoster(users []*domain.User, timestamp time.Time) *Roster {
+	return &Roster{users: users, timestamp: timestamp}
+}
+
+func (r *Roster) Users() []*domain.User {
+	return append([]*domain.User(nil), r.users...)
+}
+
+func (r *Roster) Timestamp() time.Time {
+	return r.timestamp
+}
+
+var _ domain.ServerMessage = (*Roster)(nil)
@@ -0,0 +1,185 @@
+package connection
+
+import (
+	"encoding/json"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"io"
+	"sync"
+	"time"
+)
+
+type RecordKind string
+
+const (
+	ConnectRecord RecordKind = "connect"
+	ChatRecord    RecordKind = "chat"
+	JoinRecord    RecordKind = "join"
+	LeaveRecord   RecordKind = "leave"
+	SendRecord    RecordKind = "send"
+)
+
+type RecordedUser struct {
+	Nick     string          `json:"nick"`
+	Id       string          `json:"id"`
+	Role     domain.UserRole `json:"role"`
+	JoinedAt *time.Time      `json:"joinedAt,omitempty"`
+}
+
+func recordUser(user *domain.User) *RecordedUser {
+	if user == nil {
+		return nil
+	}
+	return &RecordedUser{Nick: user.Nick(), Id: user.Id(), Role: user.Role(), JoinedAt: user.JoinedAt()}
+}
+
+func recordUsers(users []*domain.User) []RecordedUser {
+	recorded := make([]RecordedUser, 0, len(users))
+	for _, user := range users {
+		recorded = append(recorded, *recordUser(user))
+	}
+	return recorded
+}
+
+func (u *RecordedUser) user() *domain.User {
+	if u == nil {
+		return nil
+	}
+	if u.JoinedAt != nil {
+		return domain.NewOnlineUser(u.Nick, u.Id, u.Role, *u.JoinedAt)
+	}
+	return domain.NewUser(u.Nick, u.Id, u.Role)
+}
+
+func toUsers(recorded []RecordedUser) []*domain.User {
+	list := make([]*domain.User, 0, len(recorded))
+	for i := range recorded {
+		list = append(list, recorded[i].user())
+	}
+	return list
+}
+
+// Record is a line of a recording. User is the connector's user for connect records, the sender of chat messages,
+// the user who joined or left and the recipient of sent messages
+type Record struct {
+	Time       time.Time      `json:"time"`
+	Kind       RecordKind     `json:"kind"`
+	User       *RecordedUser  `json:"user,omitempty"`
+	Users      []RecordedUser `json:"users,omitempty"`
+	Recipients []RecordedUser `json:"recipients,omitempty"`
+	Message    string         `json:"message,omitempty"`
+	Mentions   bool           `json:"mentions,omitempty"`
+	Private    bool           `json:"private,omitempty"`
+	Incoming   bool           `json:"incoming,omitempty"`
+	Emote      bool           `json:"emote,omitempty"`
+}
+
+func (r *Record) chatMessage() *domain.ChatMessage {
+	return domain.NewChatMessage(r.Message, r.User.user(), toUsers(r.Recipients), r.Mentions, r.Private, r.Time, r.Incoming)
+}
+
+var _ rpc.ConnectionRelay = (*recordingRelay)(nil)
+var _ io.Closer = (*recordingRelay)(nil)
+
+type recordingRelay struct {
+	relay     rpc.ConnectionRelay
+	m         sync.Mutex
+	w         io.Writer
+	encoder   *json.Encoder
+	redaction logging.Config
+	closed    bool
+}
+
+// NewRecordingRelay returns a ConnectionRelay that writes everything going through relay to w as JSON lines,
+// with message contents redacted as redaction tells. Closing the returned relay closes w and relay if they can be closed
+func NewRecordingRelay(relay rpc.ConnectionRelay, w io.Writer, redaction logging.Config) rpc.ConnectionRelay {
+	return &recordingRelay{relay: relay, w: w, encoder: json.NewEncoder(w), redaction: redaction}
+}
+
+func (r *recordingRelay) record(record *Record) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return
+	}
+	record.Message = r.redaction.RedactContent(record.Message)
+	_ = r.encoder.Encode(record)
+}
+
+// Close stops recording and closes the recording and the recorded relay
+func (r *recordingRelay) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	var err error
+	if closer, ok := r.w.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if closer, ok := r.relay.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (r *recordingRelay) Recv() (*domain.ChatMessage, error) {
+	message, err := r.relay.Recv()
+	if err != nil {
+		return message, err
+	}
+	r.record(&Record{
+		Time:       message.Timestamp(),
+		Kind:       ChatRecord,
+		User:       recordUser(message.Sender()),
+		Recipients: recordUsers(message.Recipients()),
+		Message:    message.Message(),
+		Mentions:   message.MentionsConnectorUser(),
+		Private:    message.Private(),
+		Incoming:   message.Incoming(),
+	})
+	return message, nil
+}
+
+func (r *recordingRelay) Send(message *domain.ClientMessage) error {
+	r.record(&Record{
+		Time:    time.Now(),
+		Kind:    SendRecord,
+		User:    recordUser(message.Recipient()),
+		Message: message.Message(),
+		Private: message.Private(),
+		Emote:   message.Emote(),
+	})
+	return r.relay.Send(message)
+}
+
+func (r *recordingRelay) OnUserJoin(f func(user *domain.User, timestamp time.Time)) {
+	r.relay.OnUserJoin(func(user *domain.User, timestamp time.Time) {
+		r.record(&Record{Time: timestamp, Kind: JoinRecord, User: recordUser(user)})
+		f(user, timestamp)
+	})
+}
+
+func (r *recordingRelay) OnUserLeft(f func(user *domain.User, timestamp time.Time)) {
+	r.relay.OnUserLeft(func(user *domain.User, timestamp time.Time) {
+		r.record(&Record{Time: timestamp, Kind: LeaveRecord, User: recordUser(user)})
+		f(user, timestamp)
+	})
+}
+
+func (r *recordingRelay) Connect(nick string) (*domain.User, domain.UserList, error) {
+	user, users, err := r.relay.Connect(nick)
+	if err != nil {
+		return user, users, err
+	}
+	record := &Record{Time: time.Now(), Kind: ConnectRecord, User: recordUser(user), Message: nick}
+	if users != nil {
+		record.Users = recordUsers(users.All())
+	}
+	r.record(record)
+	return user, users, nil
+}
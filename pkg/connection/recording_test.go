@@ -0,0 +1,211 @@
+package connection
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/raf924/bot/v2/pkg/logging"
+	"github.com/raf924/connector-sdk/domain"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeRelay struct {
+	messages chan *domain.ChatMessage
+	onJoin   func(user *domain.User, timestamp time.Time)
+	onLeft   func(user *domain.User, timestamp time.Time)
+}
+
+func (f *fakeRelay) Recv() (*domain.ChatMessage, error) {
+	message, ok := <-f.messages
+	if !ok {
+		return nil, io.EOF
+	}
+	return message, nil
+}
+
+func (f *fakeRelay) Send(*domain.ClientMessage) error {
+	return nil
+}
+
+func (f *fakeRelay) OnUserJoin(fn func(user *domain.User, timestamp time.Time)) {
+	f.onJoin = fn
+}
+
+func (f *fakeRelay) OnUserLeft(fn func(user *domain.User, timestamp time.Time)) {
+	f.onLeft = fn
+}
+
+func (f *fakeRelay) Connect(nick string) (*domain.User, domain.UserList, error) {
+	return domain.NewUser(nick, "botId", domain.RegularUser), domain.NewUserList(domain.NewUser("alice", "aliceId", domain.RegularUser)), nil
+}
+
+func TestRecordingRelay_Replay(t *testing.T) {
+	relay := &fakeRelay{messages: make(chan *domain.ChatMessage, 1)}
+	var recording bytes.Buffer
+	recorder := NewRecordingRelay(relay, &recording, logging.Config{})
+	recorder.OnUserJoin(func(*domain.User, time.Time) {})
+	recorder.OnUserLeft(func(*domain.User, time.Time) {})
+	if _, _, err := recorder.Connect("bot"); err != nil {
+		t.Fatal(err)
+	}
+	bob := domain.NewUser("bob", "bobId", domain.RegularUser)
+	now := time.Now()
+	relay.onJoin(bob, now)
+	relay.messages <- domain.NewChatMessage("!echo hi", bob, nil, false, false, now, true)
+	if _, err := recorder.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Send(domain.NewClientMessage("hi", nil, false)); err != nil {
+		t.Fatal(err)
+	}
+	relay.onLeft(bob, now)
+
+	replay := NewReplayRelay(&recording, false)
+	var joined, left []string
+	events := make(chan struct{}, 2)
+	replay.OnUserJoin(func(user *domain.User, _ time.Time) {
+		joined = append(joined, user.Nick())
+		events <- struct{}{}
+	})
+	replay.OnUserLeft(func(user *domain.User, _ time.Time) {
+		left = append(left, user.Nick())
+		events <- struct{}{}
+	})
+	user, users, err := replay.Connect("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Nick() != "bot" || user.Id() != "botId" {
+		t.Errorf("expected the recorded user, got %s (%s)", user.Nick(), user.Id())
+	}
+	if alice := users.Find("alice"); alice == nil {
+		t.Error("expected alice to be online")
+	}
+	message, err := replay.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Message() != "!echo hi" || message.Sender().Nick() != "bob" {
+		t.Errorf("unexpected message %q from %s", message.Message(), message.Sender().Nick())
+	}
+	select {
+	case <-replay.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected the replay to be over")
+	}
+	if err := replay.Err(); err != nil {
+		t.Errorf("unexpected error = %v", err)
+	}
+	received := make(chan error, 1)
+	go func() {
+		_, err := replay.Recv()
+		received <- err
+	}()
+	select {
+	case err := <-received:
+		t.Fatalf("expected Recv to block once the recording is over, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if err := replay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-received; err != io.EOF {
+		t.Errorf("expected io.EOF once the relay is closed, got %v", err)
+	}
+	<-events
+	<-events
+	if len(joined) != 1 || joined[0] != "bob" || len(left) != 1 || left[0] != "bob" {
+		t.Errorf("expected bob to join and leave, got %v and %v", joined, left)
+	}
+	if _, _, err := replay.Connect("other"); err == nil {
+		t.Error("expected the recording to be replayed only once")
+	}
+}
+
+type closingWriter struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closingWriter) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRecordingRelay_Redaction(t *testing.T) {
+	relay := &fakeRelay{messages: make(chan *domain.ChatMessage, 1)}
+	var recording closingWriter
+	recorder := NewRecordingRelay(relay, &recording, logging.Config{Redact: logging.Redact})
+	bob := domain.NewUser("bob", "bobId", domain.RegularUser)
+	relay.messages <- domain.NewChatMessage("my password", bob, nil, false, false, time.Now(), true)
+	if _, err := recorder.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Send(domain.NewClientMessage("your password", bob, false)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(recording.String(), "password") || strings.Count(recording.String(), "[redacted]") != 2 {
+		t.Errorf("expected the contents to be redacted, got %s", recording.String())
+	}
+	if err := recorder.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !recording.closed {
+		t.Error("expected the recording to be closed")
+	}
+}
+
+func TestReplayRelay_InvalidConfig(t *testing.T) {
+	for name, config := range map[string]interface{}{
+		"missing file": map[string]interface{}{"file": filepath.Join(t.TempDir(), "missing.jsonl")},
+		"no file":      map[string]interface{}{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			relay := newReplayRelayFromConfig(config)
+			if relay == nil {
+				t.Fatal("expected a relay")
+			}
+			if _, _, err := relay.Connect("bot"); err == nil {
+				t.Error("expected the relay to fail to connect")
+			}
+		})
+	}
+}
+
+func TestReplayRelay_CloseStopsRealTimeReplay(t *testing.T) {
+	now := time.Now()
+	recording := fmt.Sprintf(`{"time":%q,"kind":"chat","message":"first","user":{"nick":"bob","id":"bobId"}}
+{"time":%q,"kind":"chat","message":"second","user":{"nick":"bob","id":"bobId"}}
+`, now.Format(time.RFC3339Nano), now.Add(time.Hour).Format(time.RFC3339Nano))
+	replay := NewReplayRelay(strings.NewReader(recording), true)
+	if _, _, err := replay.Connect("bot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := replay.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if err := replay.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-replay.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected closing the relay to stop the replay")
+	}
+}
+
+func TestReplayRelay_KeepsTheLastSentMessages(t *testing.T) {
+	replay := NewReplayRelay(strings.NewReader(""), false)
+	for i := 0; i <= maxSent; i++ {
+		if err := replay.Send(domain.NewClientMessage(fmt.Sprint(i), nil, false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := replay.Sent()
+	if len(sent) != maxSent || sent[0].Message() != "1" || sent[maxSent-1].Message() != fmt.Sprint(maxSent) {
+		t.Fatalf("expected the last %d messages, got %d", maxSent, len(sent))
+	}
+}
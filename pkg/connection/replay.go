@@ -0,0 +1,246 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+	"gopkg.in/yaml.v2"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	rpc.RegisterConnectionRelay("replay", newReplayRelayFromConfig)
+}
+
+// maxSent is how many of the messages sent to a ReplayRelay it keeps, the oldest ones are forgotten first
+const maxSent = 1024
+
+type ReplayConfig struct {
+	File     string `yaml:"file"`
+	RealTime bool   `yaml:"realTime"`
+}
+
+var _ rpc.ConnectionRelay = (*ReplayRelay)(nil)
+var _ io.Closer = (*ReplayRelay)(nil)
+
+// ReplayRelay is a ConnectionRelay feeding a recording made by NewRecordingRelay back to a connector.
+// It keeps the last messages the connector sends so that they can be compared with the recording.
+// Once the recording is over, Recv blocks until the relay is closed
+type ReplayRelay struct {
+	decoder   *json.Decoder
+	source    io.Closer
+	realTime  bool
+	messages  chan *domain.ChatMessage
+	over      chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+	m         sync.Mutex
+	onJoin    func(user *domain.User, timestamp time.Time)
+	onLeft    func(user *domain.User, timestamp time.Time)
+	sent      []*domain.ClientMessage
+	err       error
+	started   bool
+}
+
+// NewReplayRelay replays the recording read from r, waiting between records as long as they were apart if realTime is true.
+// r is closed with the relay if it is an io.Closer
+func NewReplayRelay(r io.Reader, realTime bool) *ReplayRelay {
+	source, _ := r.(io.Closer)
+	return &ReplayRelay{
+		decoder:  json.NewDecoder(r),
+		source:   source,
+		realTime: realTime,
+		messages: make(chan *domain.ChatMessage),
+		over:     make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// newReplayRelayFromConfig returns a relay failing to connect with the configuration error if config is invalid
+func newReplayRelayFromConfig(config interface{}) rpc.ConnectionRelay {
+	var replayConfig ReplayConfig
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return failedReplay(fmt.Errorf("invalid replay configuration: %w", err))
+	}
+	if err := yaml.Unmarshal(data, &replayConfig); err != nil {
+		return failedReplay(fmt.Errorf("invalid replay configuration: %w", err))
+	}
+	if len(replayConfig.File) == 0 {
+		return failedReplay(errors.New("invalid replay configuration: no file to replay"))
+	}
+	file, err := os.Open(replayConfig.File)
+	if err != nil {
+		return failedReplay(fmt.Errorf("couldn't open the recording: %w", err))
+	}
+	return NewReplayRelay(file, replayConfig.RealTime)
+}
+
+func failedReplay(err error) *ReplayRelay {
+	relay := NewReplayRelay(strings.NewReader(""), false)
+	relay.err = err
+	return relay
+}
+
+func (r *ReplayRelay) next() (*Record, error) {
+	var record Record
+	if err := r.decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *ReplayRelay) Connect(nick string) (*domain.User, domain.UserList, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	if r.started {
+		return nil, nil, errors.New("the recording can only be replayed once")
+	}
+	r.started = true
+	var user *domain.User
+	var users []*domain.User
+	var first *Record
+	record, err := r.next()
+	switch {
+	case err == io.EOF:
+	case err != nil:
+		return nil, nil, err
+	case record.Kind == ConnectRecord:
+		user = record.User.user()
+		users = toUsers(record.Users)
+	default:
+		first = record
+	}
+	if user == nil {
+		user = domain.NewUser(nick, nick, domain.RegularUser)
+	}
+	go r.replay(first)
+	return user, domain.NewUserList(users...), nil
+}
+
+func (r *ReplayRelay) replay(record *Record) {
+	var previous time.Time
+	var err error
+	defer close(r.over)
+	for ; err == nil; record, err = r.next() {
+		if record == nil {
+			continue
+		}
+		if r.realTime && !previous.IsZero() && record.Time.After(previous) {
+			select {
+			case <-time.After(record.Time.Sub(previous)):
+			case <-r.closed:
+				return
+			}
+		}
+		previous = record.Time
+		r.m.Lock()
+		onJoin, onLeft := r.onJoin, r.onLeft
+		r.m.Unlock()
+		switch record.Kind {
+		case ChatRecord:
+			select {
+			case r.messages <- record.chatMessage():
+			case <-r.closed:
+				return
+			}
+		case JoinRecord:
+			if onJoin != nil {
+				onJoin(record.User.user(), record.Time)
+			}
+		case LeaveRecord:
+			if onLeft != nil {
+				onLeft(record.User.user(), record.Time)
+			}
+		}
+	}
+	select {
+	case <-r.closed:
+		return
+	default:
+	}
+	if err != io.EOF {
+		r.m.Lock()
+		r.err = fmt.Errorf("couldn't read the recording: %w", err)
+		r.m.Unlock()
+	}
+}
+
+// Recv returns the next recorded chat message. It fails if the recording is malformed,
+// blocks once it is over and returns io.EOF once the relay is closed
+func (r *ReplayRelay) Recv() (*domain.ChatMessage, error) {
+	select {
+	case message := <-r.messages:
+		return message, nil
+	case <-r.over:
+		if err := r.Err(); err != nil {
+			return nil, err
+		}
+	case <-r.closed:
+		return nil, io.EOF
+	}
+	<-r.closed
+	return nil, io.EOF
+}
+
+// Done is closed once the recording was fully replayed
+func (r *ReplayRelay) Done() <-chan struct{} {
+	return r.over
+}
+
+// Err returns why the replay failed, nil while it runs or if it went through the whole recording
+func (r *ReplayRelay) Err() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.err
+}
+
+// Close stops the replay and closes the recording
+func (r *ReplayRelay) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		if r.source != nil {
+			err = r.source.Close()
+		}
+	})
+	return err
+}
+
+func (r *ReplayRelay) Send(message *domain.ClientMessage) error {
+	r.m.Lock()
+	if len(r.sent) == maxSent {
+		r.sent = append(r.sent[:0], r.sent[1:]...)
+	}
+	r.sent = append(r.sent, message)
+	r.m.Unlock()
+	return nil
+}
+
+// Sent returns the last messages sent to the relay, up to maxSent
+func (r *ReplayRelay) Sent() []*domain.ClientMessage {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]*domain.ClientMessage(nil), r.sent...)
+}
+
+func (r *ReplayRelay) OnUserJoin(f func(user *domain.User, timestamp time.Time)) {
+	r.m.Lock()
+	r.onJoin = f
+	r.m.Unlock()
+}
+
+func (r *ReplayRelay) OnUserLeft(f func(user *domain.User, timestamp time.Time)) {
+	r.m.Lock()
+	r.onLeft = f
+	r.m.Unlock()
+}
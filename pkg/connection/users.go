@@ -0,0 +1,83 @@
+package connection
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"strings"
+)
+
+// separator separates the name of a connection from the id and the nick of a user in qualified users
+const separator = "/"
+
+// emoteNick is the nick of the recipient addressing an emote to a connection
+const emoteNick = "/me"
+
+func copyUser(user *domain.User, nick string, id string) *domain.User {
+	if joinedAt := user.JoinedAt(); joinedAt != nil {
+		return domain.NewOnlineUser(nick, id, user.Role(), *joinedAt)
+	}
+	return domain.NewUser(nick, id, user.Role())
+}
+
+// Qualify returns a copy of user whose id and nick tell which connection it belongs to,
+// so that users of different connections never share them. Users of unnamed connections are returned as they are
+func Qualify(name string, user *domain.User) *domain.User {
+	if user == nil || len(name) == 0 {
+		return user
+	}
+	return copyUser(user, name+separator+user.Nick(), name+separator+user.Id())
+}
+
+// Unqualify returns the name of the connection user belongs to and a copy of user with the id and the nick it has on that connection.
+// Users that weren't qualified, such as users of unnamed connections whose ids contain a separator, are returned as they are with an empty name
+func Unqualify(user *domain.User) (string, *domain.User) {
+	if user == nil {
+		return "", nil
+	}
+	name, id, ok := strings.Cut(user.Id(), separator)
+	if !ok || len(name) == 0 {
+		return "", user
+	}
+	nick, ok := strings.CutPrefix(user.Nick(), name+separator)
+	if !ok {
+		return "", user
+	}
+	return name, copyUser(user, nick, id)
+}
+
+// Of returns the name of the connection user belongs to, empty if it wasn't qualified
+func Of(user *domain.User) string {
+	name, _ := Unqualify(user)
+	return name
+}
+
+// ReplyOn returns m addressed to the connection called name if it has no recipient or is an emote,
+// so that it is sent on that connection. Other messages and messages to unnamed connections are returned as they are
+func ReplyOn(name string, m *domain.ClientMessage) *domain.ClientMessage {
+	if len(name) == 0 || (m.Recipient() != nil && !m.Emote()) {
+		return m
+	}
+	nick := ""
+	if m.Emote() {
+		nick = emoteNick
+	}
+	return domain.NewClientMessage(m.Message(), Qualify(name, domain.NewUser(nick, "", domain.RegularUser)), m.Private())
+}
+
+// Destination returns the name of the connection m must be sent on, empty if m doesn't tell,
+// and m as that connection must receive it
+func Destination(m *domain.ClientMessage) (string, *domain.ClientMessage) {
+	if m.Emote() {
+		return "", m
+	}
+	name, recipient := Unqualify(m.Recipient())
+	switch {
+	case len(name) == 0:
+		return "", m
+	case len(recipient.Id()) > 0:
+		return name, domain.NewClientMessage(m.Message(), recipient, m.Private())
+	case recipient.Nick() == emoteNick:
+		return name, domain.NewEmote(m.Message())
+	default:
+		return name, domain.NewClientMessage(m.Message(), nil, m.Private())
+	}
+}
@@ -4,16 +4,54 @@ import (
 	"github.com/raf924/bot/v2/internal/pkg/connector"
 	"github.com/raf924/bot/v2/pkg"
 	cnf "github.com/raf924/bot/v2/pkg/config/connector"
+	botConnection "github.com/raf924/bot/v2/pkg/connection"
+	"github.com/raf924/bot/v2/pkg/logging"
 	"github.com/raf924/connector-sdk/rpc"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
 func NewConnector(config cnf.Config) pkg.Runnable {
-	connection := GetConnectionRelay(config)
+	return NewConnectorWithLogger(config, nil)
+}
+
+// NewConnectorWithLogger returns a connector logging to logger, or to stderr as config.Log describes when it is nil
+func NewConnectorWithLogger(config cnf.Config, logger *slog.Logger) pkg.Runnable {
+	if logger == nil {
+		logger = logging.New(config.Log, os.Stderr)
+	}
+	connections := GetConnections(config)
+	for i, connection := range connections {
+		connections[i].Relay = record(config, connection, len(connections) > 1, logger)
+	}
 	connectorRelay := GetConnectorRelay(config)
-	return connector.NewConnector(config, connection, connectorRelay)
+	return connector.NewMultiConnector(config, connections, connectorRelay, logger)
 }
 
 var _ = NewConnector
+var _ = NewConnectorWithLogger
+
+// record wraps the relay of connection in a recording relay when recording is enabled.
+// When several connections are recorded, each one gets its own file named after it.
+// Message contents are redacted as they are in the logs, and the file is only readable by its owner
+func record(config cnf.Config, connection connector.Connection, several bool, logger *slog.Logger) rpc.ConnectionRelay {
+	if len(config.Record.File) == 0 || connection.Relay == nil {
+		return connection.Relay
+	}
+	fileName := config.Record.File
+	if several {
+		extension := filepath.Ext(fileName)
+		fileName = strings.TrimSuffix(fileName, extension) + "." + connection.Name + extension
+	}
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		logger.Error("couldn't open the recording file", "file", fileName, "error", err)
+		return connection.Relay
+	}
+	return botConnection.NewRecordingRelay(connection.Relay, file, config.Log)
+}
 
 func GetConnectorRelay(config cnf.Config) rpc.ConnectorRelay {
 	for relayKey, relayConfig := range config.Bot {
@@ -26,7 +64,11 @@ func GetConnectorRelay(config cnf.Config) rpc.ConnectorRelay {
 }
 
 func GetConnectionRelay(config cnf.Config) rpc.ConnectionRelay {
-	for relayKey, relayConfig := range config.Connection {
+	return getConnectionRelay(config.Connection)
+}
+
+func getConnectionRelay(relays map[string]interface{}) rpc.ConnectionRelay {
+	for relayKey, relayConfig := range relays {
 		relayBuilder := rpc.GetConnectionRelay(relayKey)
 		if relayBuilder != nil {
 			return relayBuilder(relayConfig)
@@ -34,3 +76,21 @@ func GetConnectionRelay(config cnf.Config) rpc.ConnectionRelay {
 	}
 	return nil
 }
+
+// GetConnections returns the connections listed in config.Connections, or the one in config.Connection if there are none
+func GetConnections(config cnf.Config) []connector.Connection {
+	if len(config.Connections) == 0 {
+		return []connector.Connection{{Relay: GetConnectionRelay(config)}}
+	}
+	var connections []connector.Connection
+	for _, connectionConfig := range config.Connections {
+		connections = append(connections, connector.Connection{
+			Name:      connectionConfig.Name,
+			Trigger:   connectionConfig.Trigger,
+			Relay:     getConnectionRelay(connectionConfig.Relay),
+			MaxLength: connectionConfig.MaxLength,
+			Unit:      connectionConfig.Unit,
+		})
+	}
+	return connections
+}
@@ -0,0 +1,18 @@
+package dispatch
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"github.com/raf924/connector-sdk/rpc"
+)
+
+// Authenticator decides whether the connector accepts a dispatcher presenting handshake to register commands,
+// it returns why the dispatcher is rejected
+type Authenticator interface {
+	Authenticate(handshake Handshake, commands domain.CommandList) error
+}
+
+// Admitter is implemented by the rpc.ConnectorRelay of a relay that lets the connector vet dispatchers before accepting them.
+// The relay refuses the dispatchers admit rejects and ends their session
+type Admitter interface {
+	SetAdmission(admit func(dispatcher rpc.Dispatcher) error)
+}
@@ -0,0 +1,32 @@
+package dispatch
+
+import (
+	"errors"
+	"time"
+)
+
+// Closer is implemented by the rpc.Dispatcher of a relay that can end a dispatcher's session.
+// The connector closes the dispatchers it rejects or disconnects
+type Closer interface {
+	Close(reason error) error
+}
+
+// Disconnection is dispatched to a dispatcher that isn't a Closer to tell it the connector dropped it,
+// if its handshake declared ConnectorMessages
+type Disconnection struct {
+	reason    string
+	timestamp time.Time
+}
+
+func NewDisconnection(reason error, timestamp time.Time) *Disconnection {
+	return &Disconnection{reason: reason.Error(), timestamp: timestamp}
+}
+
+func (d *Disconnection) Timestamp() time.Time {
+	return d.timestamp
+}
+
+// Err returns why the dispatcher was dropped
+func (d *Disconnection) Err() error {
+	return errors.New(d.reason)
+}
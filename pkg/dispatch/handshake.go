@@ -0,0 +1,50 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/raf924/connector-sdk/domain"
+)
+
+// HandshakeCommand names the command carrying the handshake in a registration.
+// Users can't invoke it since it contains a space
+const HandshakeCommand = "dispatch handshake"
+
+// Handshake is what a dispatcher presents to the connector along with its commands.
+// It travels in the registration so that every relay carries it
+type Handshake struct {
+	Token    string   `json:"token,omitempty"`
+	Identity Identity `json:"identity"`
+	// Subscription is nil when the dispatcher receives everything
+	Subscription *Subscription `json:"subscription,omitempty"`
+	// ConnectorMessages tells that the dispatcher understands the messages of this connector besides the SDK's,
+	// the roster and Disconnection. Other dispatchers receive the roster as UserJoined events
+	ConnectorMessages bool `json:"connectorMessages,omitempty"`
+}
+
+// Registration returns the registration of commands presenting h
+func (h Handshake) Registration(commands []*domain.Command) (*domain.RegistrationMessage, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	registered := append([]*domain.Command{domain.NewCommand(HandshakeCommand, nil, string(data))}, commands...)
+	return domain.NewRegistrationMessage(registered), nil
+}
+
+// ReadHandshake splits the handshake off the commands of a dispatcher.
+// A dispatcher that didn't present one gets an empty handshake
+func ReadHandshake(commands domain.CommandList) (Handshake, domain.CommandList, error) {
+	var handshake Handshake
+	registered := domain.NewCommandList()
+	for _, cmd := range commands.All() {
+		if cmd.Name() != HandshakeCommand {
+			registered.Add(cmd)
+			continue
+		}
+		if err := json.Unmarshal([]byte(cmd.Usage()), &handshake); err != nil {
+			return Handshake{}, nil, fmt.Errorf("invalid handshake: %w", err)
+		}
+	}
+	return handshake, domain.ImmutableCommandList(registered), nil
+}
@@ -0,0 +1,31 @@
+package dispatch
+
+import (
+	"errors"
+	"strings"
+)
+
+// Identity names a dispatcher so the connector can tell bots apart in its help, status and logs.
+// A dispatcher without a name is given a random one
+type Identity struct {
+	Name    string `yaml:"name" json:"name,omitempty"`
+	Version string `yaml:"version" json:"version,omitempty"`
+}
+
+// Validate fails if the name can't be used as a command namespace
+func (i Identity) Validate() error {
+	if len(i.Name) == 0 {
+		return errors.New("missing name")
+	}
+	if strings.ContainsAny(i.Name, ": \t\n") {
+		return errors.New("the name can't contain colons or spaces")
+	}
+	return nil
+}
+
+func (i Identity) String() string {
+	if len(i.Version) == 0 {
+		return i.Name
+	}
+	return i.Name + "@" + i.Version
+}
@@ -0,0 +1,58 @@
+package dispatch
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"regexp"
+)
+
+// Subscription declares what a dispatcher wants to receive from the connector besides the commands it registered
+type Subscription struct {
+	// Chat receives the chat messages matching one of these regular expressions, or every private one when PrivateOnly is set without any
+	Chat []string `yaml:"chat" json:"chat,omitempty"`
+	// UserEvents receives users joining and leaving as well as the connector's own events
+	UserEvents bool `yaml:"userEvents" json:"userEvents,omitempty"`
+	// PrivateOnly restricts commands and chat messages to private ones
+	PrivateOnly bool `yaml:"privateOnly" json:"privateOnly,omitempty"`
+}
+
+// Filter tells whether a message belongs to a subscription
+type Filter struct {
+	subscription Subscription
+	chat         []*regexp.Regexp
+}
+
+// Compile returns the Filter of s, failing if one of its expressions is invalid
+func (s Subscription) Compile() (*Filter, error) {
+	filter := &Filter{subscription: s}
+	for _, expression := range s.Chat {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, err
+		}
+		filter.chat = append(filter.chat, re)
+	}
+	return filter, nil
+}
+
+func (f *Filter) Accepts(message domain.ServerMessage) bool {
+	switch message := message.(type) {
+	case *domain.CommandMessage:
+		return !f.subscription.PrivateOnly || message.Private()
+	case *domain.ChatMessage:
+		if f.subscription.PrivateOnly && !message.Private() {
+			return false
+		}
+		if f.subscription.PrivateOnly && len(f.chat) == 0 {
+			return true
+		}
+		for _, re := range f.chat {
+			if re.MatchString(message.Message()) {
+				return true
+			}
+		}
+		return false
+	case *domain.UserEvent:
+		return f.subscription.UserEvents
+	}
+	return true
+}
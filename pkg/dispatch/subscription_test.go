@@ -0,0 +1,43 @@
+package dispatch
+
+import (
+	"github.com/raf924/connector-sdk/domain"
+	"testing"
+	"time"
+)
+
+func TestFilter_Accepts(t *testing.T) {
+	user := domain.NewUser("user", "userId", domain.RegularUser)
+	tests := []struct {
+		name         string
+		subscription Subscription
+		message      domain.ServerMessage
+		want         bool
+	}{
+		{"command", Subscription{}, domain.NewCommandMessage("roll", nil, "", user, false, time.Now()), true},
+		{"public command", Subscription{PrivateOnly: true}, domain.NewCommandMessage("roll", nil, "", user, false, time.Now()), false},
+		{"private command", Subscription{PrivateOnly: true}, domain.NewCommandMessage("roll", nil, "", user, true, time.Now()), true},
+		{"matching chat", Subscription{Chat: []string{"^https?://"}}, domain.NewChatMessage("https://example.com", user, nil, false, false, time.Now(), true), true},
+		{"other chat", Subscription{Chat: []string{"^https?://"}}, domain.NewChatMessage("hello", user, nil, false, false, time.Now(), true), false},
+		{"no chat", Subscription{}, domain.NewChatMessage("hello", user, nil, false, false, time.Now(), true), false},
+		{"private chat", Subscription{PrivateOnly: true}, domain.NewChatMessage("hello", user, nil, false, true, time.Now(), true), true},
+		{"public chat", Subscription{PrivateOnly: true}, domain.NewChatMessage("hello", user, nil, false, false, time.Now(), true), false},
+		{"private unmatched chat", Subscription{Chat: []string{"^https?://"}, PrivateOnly: true}, domain.NewChatMessage("hello", user, nil, false, true, time.Now(), true), false},
+		{"user event", Subscription{UserEvents: true}, domain.NewUserEvent(user, domain.UserJoined, time.Now()), true},
+		{"no user events", Subscription{}, domain.NewUserEvent(user, domain.UserJoined, time.Now()), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.subscription.Compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Accepts(tt.message); got != tt.want {
+				t.Errorf("Accepts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := (Subscription{Chat: []string{"("}}).Compile(); err == nil {
+		t.Error("expected an invalid expression to fail")
+	}
+}
@@ -3,22 +3,30 @@ package pkg
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
 type ErrorContext struct {
 	context.Context
 	parentCtx  context.Context
 	cancelFunc context.CancelFunc
+	m          sync.Mutex
 	err        error
 }
 
 func (e *ErrorContext) CancelWithError(err error) {
-	e.err = err
+	e.m.Lock()
+	if e.Context.Err() == nil {
+		e.err = err
+	}
+	e.m.Unlock()
 	e.cancelFunc()
 }
 
 func (e *ErrorContext) Err() error {
 	if e.parentCtx.Err() == nil {
+		e.m.Lock()
+		defer e.m.Unlock()
 		return e.err
 	}
 	return fmt.Errorf("parent context was cancelled: %w", e.parentCtx.Err())
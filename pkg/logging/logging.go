@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redaction decides how message contents appear in the logs
+type Redaction string
+
+const (
+	// Plain logs message contents as they are
+	Plain Redaction = "none"
+	// Redact replaces message contents with a placeholder
+	Redact Redaction = "redact"
+	// Hash replaces message contents with a short HMAC keyed with the configured secret so that identical messages can still be correlated
+	Hash Redaction = "hash"
+)
+
+// Field names shared by the connector and the bot
+const (
+	DispatcherKey = "dispatcher"
+	CommandKey    = "command"
+	UserKey       = "user_id"
+	ContentKey    = "content"
+)
+
+type Config struct {
+	// Level is one of debug, info, warn or error, info by default
+	Level string `yaml:"level"`
+	// Format is either text or json, text by default
+	Format string    `yaml:"format"`
+	Redact Redaction `yaml:"redact"`
+	// Secret keys the hashes of message contents, it is required by the hash redaction
+	Secret string `yaml:"secret"`
+}
+
+// Validate checks that the hash redaction has a secret
+func (c Config) Validate() error {
+	if c.Redact == Hash && len(c.Secret) == 0 {
+		return errors.New("the hash redaction requires a secret")
+	}
+	return nil
+}
+
+func level(name string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// New returns a logger writing to w as described by config
+func New(config Config, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level(config.Level)}
+	if strings.EqualFold(config.Format, "json") {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// Content returns the attribute logging a message's content according to the redaction of config
+func Content(config Config, content string) slog.Attr {
+	return slog.String(ContentKey, config.RedactContent(content))
+}
+
+// RedactContent returns content as the redaction of config lets it appear, contents are redacted if hashing them has no secret
+func (c Config) RedactContent(content string) string {
+	switch c.Redact {
+	case Redact:
+		return "[redacted]"
+	case Hash:
+		if len(c.Secret) == 0 {
+			return "[redacted]"
+		}
+		mac := hmac.New(sha256.New, []byte(c.Secret))
+		mac.Write([]byte(content))
+		return hex.EncodeToString(mac.Sum(nil)[:6])
+	default:
+		return content
+	}
+}
+
+// OrDefault returns logger or slog's default logger if it is nil
+func OrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
+}
@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"testing"
+)
+
+func TestContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{name: "none", config: Config{Redact: Plain}, want: "hello"},
+		{name: "default", want: "hello"},
+		{name: "redact", config: Config{Redact: Redact}, want: "[redacted]"},
+		{name: "hash", config: Config{Redact: Hash, Secret: "secret"}, want: "88aab3ede8d3"},
+		{name: "hash without secret", config: Config{Redact: Hash}, want: "[redacted]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attr := Content(tt.config, "hello")
+			if attr.Key != ContentKey || attr.Value.String() != tt.want {
+				t.Errorf("Content() = %v, want %s", attr, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if err := (Config{Redact: Hash}).Validate(); err == nil {
+		t.Error("expected the hash redaction to require a secret")
+	}
+	if err := (Config{Redact: Hash, Secret: "secret"}).Validate(); err != nil {
+		t.Errorf("unexpected error = %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+// DefaultBuckets are the histogram buckets used when none are given, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the connector and the bot record their metrics in
+var Default = NewRegistry()
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	count       uint64
+}
+
+type family struct {
+	m          sync.Mutex
+	name       string
+	help       string
+	metricType metricType
+	labels     []string
+	buckets    []float64
+	series     map[string]*series
+}
+
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues, buckets: make([]uint64, len(f.buckets))}
+		f.series[key] = s
+	}
+	return s
+}
+
+var (
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// label formats a label pair, escaping backslashes, double quotes and line feeds in value as Prometheus expects
+func label(name string, value string) string {
+	return name + `="` + labelValueEscaper.Replace(value) + `"`
+}
+
+func (f *family) labelString(labelValues []string, extra ...string) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, label(name, labelValues[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, label(extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (f *family) write(w io.Writer) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, helpEscaper.Replace(f.help), f.name, f.metricType); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.metricType != histogramType {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.labelValues), formatFloat(s.value)); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, bound := range f.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "le", formatFloat(bound)), s.buckets[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			f.name, f.labelString(s.labelValues, "le", "+Inf"), s.count,
+			f.name, f.labelString(s.labelValues), formatFloat(s.value),
+			f.name, f.labelString(s.labelValues), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Registry holds metric families and writes them in the Prometheus text format
+type Registry struct {
+	m        sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// family returns the family called name, creating it if it doesn't exist yet
+func (r *Registry) family(name string, help string, metricType metricType, labels []string, buckets []float64) *family {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if f, ok := r.families[name]; ok {
+		if f.metricType != metricType {
+			panic(fmt.Sprintf("metric %s is already registered as a %s", name, f.metricType))
+		}
+		return f
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labels:     labels,
+		buckets:    buckets,
+		series:     map[string]*series{},
+	}
+	r.families[name] = f
+	return f
+}
+
+// Write writes every metric of r to w in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.m.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.m.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the metrics of r in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+type Counter struct {
+	family *family
+}
+
+func (r *Registry) Counter(name string, help string, labels ...string) *Counter {
+	return &Counter{family: r.family(name, help, counterType, labels, nil)}
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return Default.Counter(name, help, labels...)
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.family.m.Lock()
+	defer c.family.m.Unlock()
+	c.family.get(labelValues).value += v
+}
+
+type Gauge struct {
+	family *family
+}
+
+func (r *Registry) Gauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{family: r.family(name, help, gaugeType, labels, nil)}
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return Default.Gauge(name, help, labels...)
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.family.m.Lock()
+	defer g.family.m.Unlock()
+	g.family.get(labelValues).value = v
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.family.m.Lock()
+	defer g.family.m.Unlock()
+	g.family.get(labelValues).value += v
+}
+
+type Histogram struct {
+	family *family
+}
+
+// Histogram returns a histogram using buckets as upper bounds, DefaultBuckets if there are none
+func (r *Registry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{family: r.family(name, help, histogramType, labels, buckets)}
+}
+
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.Histogram(name, help, buckets, labels...)
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.family.m.Lock()
+	defer h.family.m.Unlock()
+	s := h.family.get(labelValues)
+	for i, bound := range h.family.buckets {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
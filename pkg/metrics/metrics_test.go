@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	commands := r.Counter("commands_total", "Commands executed", "command")
+	commands.Inc("echo")
+	commands.Add(2, "ban")
+	r.Gauge("dispatchers", "Attached dispatchers").Set(3)
+	latency := r.Histogram("latency_seconds", "Latency", []float64{1, 0.1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP commands_total Commands executed
+# TYPE commands_total counter
+commands_total{command="ban"} 2
+commands_total{command="echo"} 1
+# HELP dispatchers Attached dispatchers
+# TYPE dispatchers gauge
+dispatchers 3
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 2
+latency_seconds_sum 0.55
+latency_seconds_count 2
+`
+	if b.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestRegistry_ReusesFamilies(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("total", "Total").Inc()
+	r.Counter("total", "Total").Inc()
+	var b strings.Builder
+	_ = r.Write(&b)
+	if !strings.Contains(b.String(), "total 2\n") {
+		t.Fatalf("expected both counters to share their value, got\n%s", b.String())
+	}
+}
+
+func TestRegistry_Escaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("total", "Path \\ with\n\"quotes\"", "path").Inc("C:\\dir\n\"é\"\t")
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP total Path \\ with\n"quotes"
+# TYPE total counter
+total{path="C:\\dir\n\"é\"	"} 1
+`
+	if b.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestRegistry_WritesAfterLabelMismatch(t *testing.T) {
+	r := NewRegistry()
+	commands := r.Counter("commands_total", "Commands executed", "command")
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a label mismatch to panic")
+			}
+		}()
+		commands.Inc()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		var b strings.Builder
+		done <- r.Write(&b)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the metrics to be written")
+	}
+}
@@ -1,9 +1,34 @@
 package pkg
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrStopped is the error of a Runnable that was stopped gracefully
+var ErrStopped = errors.New("stopped")
 
 type Runnable interface {
 	Start(ctx context.Context) error
 	Done() <-chan struct{}
 	Err() error
 }
+
+// Stopper is implemented by Runnables that can shut down gracefully.
+// Stop stops accepting input, flushes what is pending until ctx is done and then stops the Runnable with ErrStopped
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Drainer is implemented by relays that buffer messages, Pending returns how many of them weren't handled yet
+type Drainer interface {
+	Pending() int
+}
+
+// Stop stops r gracefully if it is a Stopper
+func Stop(ctx context.Context, r Runnable) error {
+	if stopper, ok := r.(Stopper); ok {
+		return stopper.Stop(ctx)
+	}
+	return nil
+}